@@ -11,6 +11,9 @@ import (
 	"github/eventApp/internal/service"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/julienschmidt/httprouter"
@@ -35,17 +38,6 @@ func main() {
 	}
 
 	db := bun.NewDB(sqlDb, pgdialect.New())
-	es, err := elasticsearch.NewTypedClient(elasticsearch.Config{
-		Addresses: config.ELASTIC_SEARCH_ADDRESSES,
-	})
-	if err != nil {
-		log.Fatalf("Error creating the elastic search client: %v", err)
-	}
-
-	_, err = es.Info().Do(context.Background())
-	if err != nil {
-		log.Fatalf("Error pinging Elasticsearch: %v", err)
-	}
 
 	/* repositories */
 	groupToUserRep, err := repository.NewGroupToUserRepository(db, context.Background())
@@ -68,14 +60,122 @@ func main() {
 		log.Fatalf("Error creating event repository: %v", err)
 	}
 
-	eventSearchRep, err := repository.NewEventSearchRepository(es, context.Background())
+	rsvpRep, err := repository.NewRSVPRepository(db, context.Background())
+	if err != nil {
+		log.Fatalf("Error creating rsvp repository: %v", err)
+	}
+
+	calendarImportRep, err := repository.NewCalendarImportRepository(db, context.Background())
+	if err != nil {
+		log.Fatalf("Error creating calendar import repository: %v", err)
+	}
+
+	outboxRep, err := repository.NewOutboxRepository(db, context.Background())
+	if err != nil {
+		log.Fatalf("Error creating outbox repository: %v", err)
+	}
+
+	danceStyleRep, err := repository.NewDanceStyleRepository(db, context.Background())
 	if err != nil {
-		log.Fatalf("Error creating event search repository: %v", err)
+		log.Fatalf("Error creating dance style repository: %v", err)
+	}
+
+	regionRep, err := repository.NewRegionRepository(config.REGIONS_FILE)
+	if err != nil {
+		log.Fatalf("Error loading regions: %v", err)
 	}
 
 	userService := service.NewUserService(userRep)
 	groupService := service.NewGroupService(groupRep)
-	eventService := service.NewEventService(eventRep, eventSearchRep)
+
+	var eventService *service.EventService
+	var reindexService *service.ReindexService
+
+	switch config.SEARCH_BACKEND {
+	case "elasticsearch":
+		es, err := elasticsearch.NewTypedClient(elasticsearch.Config{
+			Addresses: config.ELASTIC_SEARCH_ADDRESSES,
+		})
+		if err != nil {
+			log.Fatalf("Error creating the elastic search client: %v", err)
+		}
+
+		// Searches fall back to postgres while Elasticsearch is down, so
+		// it being unreachable at startup isn't fatal.
+		_, err = es.Info().Do(context.Background())
+		if err != nil {
+			log.Printf("Error pinging Elasticsearch: %v", err)
+		}
+
+		eventSearchRep, err := repository.NewEventSearchRepository(es, context.Background())
+		if err != nil {
+			log.Printf("Error creating event search indices: %v", err)
+		}
+
+		eventService = service.NewEventService(eventRep, eventSearchRep, rsvpRep)
+		eventService.UseSearchFallback(eventRep, config.SEARCH_BREAKER_THRESHOLD, config.SEARCH_BREAKER_COOLDOWN, config.SEARCH_TIMEOUT)
+		reindexService = service.NewReindexService(eventRep, eventSearchRep, outboxRep)
+	case "postgres":
+		eventSearchRep, err := repository.NewEventPostgresSearchRepository(db, context.Background())
+		if err != nil {
+			log.Fatalf("Error creating postgres event search repository: %v", err)
+		}
+
+		eventService = service.NewEventService(eventRep, eventSearchRep, rsvpRep)
+	default:
+		log.Fatalf("Unknown search backend %q", config.SEARCH_BACKEND)
+	}
+
+	eventService.UseRegions(regionRep)
+	eventService.UseDanceStyles(danceStyleRep)
+
+	danceStyleService := service.NewDanceStyleService(danceStyleRep)
+
+	rsvpService := service.NewRSVPService(rsvpRep, eventRep)
+	calendarImportService := service.NewCalendarImportService(calendarImportRep, eventRep, eventService, service.NewCalendarFeedClient(30*time.Second))
+	outboxService := service.NewOutboxService(outboxRep, eventService, config.OUTBOX_MAX_ATTEMPTS)
+
+	/* one-off commands
+	 */
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dedupe-index":
+			removed, err := eventService.DeduplicateSearchIndex(context.Background())
+			if err != nil {
+				log.Fatalf("Error deduplicating the search index: %v", err)
+			}
+			log.Printf("Removed %d duplicate documents from the search index", removed)
+		case "normalize-levels":
+			changed, err := eventService.NormalizeLevels(context.Background())
+			if err != nil {
+				log.Fatalf("Error normalizing event levels: %v", err)
+			}
+			log.Printf("Normalized the levels of %d events", changed)
+		case "normalize-types":
+			changed, err := eventService.NormalizeEventKinds(context.Background())
+			if err != nil {
+				log.Fatalf("Error normalizing event types: %v", err)
+			}
+			log.Printf("Normalized the types of %d events", changed)
+		case "reindex":
+			if reindexService == nil {
+				log.Fatalf("Reindexing needs the elasticsearch search backend")
+			}
+			result, err := reindexService.Reindex(context.Background())
+			if err != nil {
+				log.Fatalf("Error reindexing events: %v", err)
+			}
+			log.Printf("Reindexed %d events as %d documents into %s, replaying %d recent changes", result.Events, result.Documents, result.Index, result.Requeued)
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		return
+	}
+
+	go calendarImportService.Run(config.ICS_SYNC_INTERVAL, context.Background())
+	go outboxService.Run(config.OUTBOX_POLL_INTERVAL, context.Background())
+	go outboxService.RunRecurrenceRefresh(config.RECURRENCE_REFRESH_INTERVAL, context.Background())
 	groupToUserService := service.NewGroupToUserService(groupToUserRep)
 	loginService := service.NewLoginService(config.JWTSECRET, userRep)
 
@@ -88,18 +188,44 @@ func main() {
 	router.POST("/users", handlers.CreateUser(userService))
 	router.GET("/users/:userId", middleware.Auth(config.JWTSECRET, handlers.GetUser(userService)))
 	router.PATCH("/users/:userId", middleware.Auth(config.JWTSECRET, handlers.UpdateUser(userService)))
+	router.POST("/users/:userId/calendar-token", middleware.Auth(config.JWTSECRET, handlers.RotateCalendarToken(userService)))
+	router.GET("/users/:userId/events.ics", middleware.CalendarAuth(userRep, handlers.GetUserCalendar(eventService)))
 
 	router.POST("/groups", middleware.Auth(config.JWTSECRET, handlers.CreateGroup(groupService)))
 	router.GET("/groups", middleware.Auth(config.JWTSECRET, handlers.GetGroups(groupService)))
 	router.PUT("/groups/:groupId", middleware.Auth(config.JWTSECRET, handlers.UpdateGroup(groupService)))
 	router.GET("/groups/:groupId/events", middleware.Auth(config.JWTSECRET, handlers.GetEvents(eventService)))
-	router.POST("/groups/:groupId/events", middleware.Auth(config.JWTSECRET, handlers.CreateEvent(eventService)))
-	router.PUT("/groups/:groupId/events/:eventId", middleware.Auth(config.JWTSECRET, handlers.UpdateEvent(eventService)))
+	router.GET("/groups/:groupId/events.ics", middleware.CalendarAuth(userRep, handlers.GetGroupCalendar(eventService)))
+	router.GET("/groups/:groupId/imports", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.GetCalendarImports(calendarImportService))))
+	router.POST("/groups/:groupId/imports", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.CreateCalendarImport(calendarImportService))))
+	router.POST("/groups/:groupId/imports/upload", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.UploadCalendar(calendarImportService))))
+	router.POST("/groups/:groupId/events", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.CreateEvent(eventService))))
+	router.PUT("/groups/:groupId/events/:eventId", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.UpdateEvent(eventService))))
+	router.DELETE("/groups/:groupId/events/:eventId", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.DeleteEvent(eventService))))
+	router.POST("/groups/:groupId/events/:eventId/cancel", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.CancelEvent(eventService, true))))
+	router.DELETE("/groups/:groupId/events/:eventId/cancel", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.CancelEvent(eventService, false))))
+	router.GET("/groups/:groupId/events/:eventId/similar", middleware.Auth(config.JWTSECRET, handlers.GetSimilarEvents(eventService)))
+	router.GET("/groups/:groupId/events/:eventId/rsvp", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.GetRSVPs(rsvpService))))
+	router.PUT("/groups/:groupId/events/:eventId/rsvp", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.SetRSVP(rsvpService))))
+	router.DELETE("/groups/:groupId/events/:eventId/rsvp", middleware.Auth(config.JWTSECRET, middleware.GroupMember(groupToUserRep, config.ADMIN_USER_IDS, handlers.RemoveRSVP(rsvpService))))
 
 	router.POST("/groups/:groupId/users/:userId", middleware.Auth(config.JWTSECRET, handlers.AddUserToGroup(groupToUserService)))
 	router.DELETE("/groups/:groupId/users/:userId", middleware.Auth(config.JWTSECRET, handlers.RemoveUserFromGroup(groupToUserService)))
 
-	router.GET("/events", middleware.Auth(config.JWTSECRET, handlers.GetEventsByDistance(eventService)))
+	router.GET("/events", middleware.Auth(config.JWTSECRET, handlers.SearchEvents(eventService)))
+	router.GET("/events/stats", middleware.Auth(config.JWTSECRET, handlers.GetEventStats(eventService)))
+	router.GET("/events/suggest", middleware.Auth(config.JWTSECRET, handlers.SuggestEvents(eventService)))
+	router.GET("/events/map", middleware.Auth(config.JWTSECRET, handlers.GetMapEvents(eventService)))
+	router.GET("/regions", middleware.Auth(config.JWTSECRET, handlers.GetRegions(eventService)))
+	router.GET("/dance-styles", middleware.Auth(config.JWTSECRET, handlers.GetDanceStyles(danceStyleService)))
+	router.GET("/event-kinds", middleware.Auth(config.JWTSECRET, handlers.GetEventKinds(eventService)))
+	router.GET("/tiles/events/:z/:x/:tile", middleware.Auth(config.JWTSECRET, handlers.GetEventTile(eventService)))
+
+	router.GET("/admin/outbox", middleware.Auth(config.JWTSECRET, middleware.Admin(config.ADMIN_USER_IDS, handlers.GetOutboxStatus(outboxService))))
+	router.POST("/admin/outbox/retry", middleware.Auth(config.JWTSECRET, middleware.Admin(config.ADMIN_USER_IDS, handlers.RetryOutbox(outboxService))))
+	router.POST("/admin/dance-styles", middleware.Auth(config.JWTSECRET, middleware.Admin(config.ADMIN_USER_IDS, handlers.CreateDanceStyle(danceStyleService))))
+	router.PUT("/admin/dance-styles/:styleId", middleware.Auth(config.JWTSECRET, middleware.Admin(config.ADMIN_USER_IDS, handlers.UpdateDanceStyle(danceStyleService))))
+	router.DELETE("/admin/dance-styles/:styleId", middleware.Auth(config.JWTSECRET, middleware.Admin(config.ADMIN_USER_IDS, handlers.DeleteDanceStyle(danceStyleService))))
 	http.ListenAndServe(fmt.Sprintf(":%v", config.PORT), router)
 
 }
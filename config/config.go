@@ -1,12 +1,26 @@
 package config
 
-import "github.com/caarlos0/env"
+import (
+	"time"
+
+	"github.com/caarlos0/env"
+)
 
 type Config struct {
-	POSTGRES_DB              string   `env:"POSTGRES_DB" envDefault:"postgres"`
-	PORT                     int      `env:"PORT" envDefault:"8181"`
-	JWTSECRET                string   `env:"JWT_SECRET" envDefault:"jwtsecret"`
-	ELASTIC_SEARCH_ADDRESSES []string `env:"ELASTIC_SEARCH_ADDRESSES" envDefault:"http://localhost:9200" envSeparator:","`
+	POSTGRES_DB                 string        `env:"POSTGRES_DB" envDefault:"postgres"`
+	PORT                        int           `env:"PORT" envDefault:"8181"`
+	JWTSECRET                   string        `env:"JWT_SECRET" envDefault:"jwtsecret"`
+	ELASTIC_SEARCH_ADDRESSES    []string      `env:"ELASTIC_SEARCH_ADDRESSES" envDefault:"http://localhost:9200" envSeparator:","`
+	ICS_SYNC_INTERVAL           time.Duration `env:"ICS_SYNC_INTERVAL" envDefault:"1h"`
+	OUTBOX_POLL_INTERVAL        time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"`
+	OUTBOX_MAX_ATTEMPTS         int           `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"10"`
+	RECURRENCE_REFRESH_INTERVAL time.Duration `env:"RECURRENCE_REFRESH_INTERVAL" envDefault:"24h"`
+	SEARCH_BACKEND              string        `env:"SEARCH_BACKEND" envDefault:"elasticsearch"`
+	SEARCH_TIMEOUT              time.Duration `env:"SEARCH_TIMEOUT" envDefault:"2s"`
+	SEARCH_BREAKER_THRESHOLD    int           `env:"SEARCH_BREAKER_THRESHOLD" envDefault:"3"`
+	SEARCH_BREAKER_COOLDOWN     time.Duration `env:"SEARCH_BREAKER_COOLDOWN" envDefault:"30s"`
+	ADMIN_USER_IDS              []int64       `env:"ADMIN_USER_IDS" envSeparator:","`
+	REGIONS_FILE                string        `env:"REGIONS_FILE"`
 }
 
 func New() (*Config, error) {
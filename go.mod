@@ -3,10 +3,12 @@ module github/eventApp
 go 1.24.0
 
 require (
+	github.com/arran4/golang-ical v0.3.2
 	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/elastic/go-elasticsearch/v8 v8.18.0
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/teambition/rrule-go v1.8.2
 	github.com/uptrace/bun v1.2.11
 	github.com/uptrace/bun/dialect/pgdialect v1.2.11
 	github.com/uptrace/bun/driver/pgdriver v1.2.11
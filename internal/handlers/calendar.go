@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github/eventApp/internal/middleware"
+	"github/eventApp/internal/service"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func writeCalendar(w http.ResponseWriter, cal string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(cal))
+}
+
+func GetGroupCalendar(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		cal, err := s.GroupCalendar(groupIDint, ctx)
+		if err != nil {
+			log.Printf("Error building group calendar: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeCalendar(w, cal)
+	}
+}
+
+func GetUserCalendar(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		userID := p.ByName(userIDParam)
+		userIDint, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting user id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tokenUserID, _ := middleware.UserID(r.Context())
+		if tokenUserID != userIDint {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		cal, err := s.UserCalendar(userIDint, ctx)
+		if err != nil {
+			log.Printf("Error building user calendar: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeCalendar(w, cal)
+	}
+}
+
+func RotateCalendarToken(s *service.UserService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		userID := p.ByName(userIDParam)
+		userIDint, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting user id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tokenUserID, _ := middleware.UserID(r.Context())
+		if tokenUserID != userIDint {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		token, err := s.RotateCalendarToken(userIDint, ctx)
+		if err != nil {
+			log.Printf("Error rotating calendar token: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(token)
+		if err != nil {
+			log.Printf("Error marshalling calendar token response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
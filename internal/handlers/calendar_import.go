@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github/eventApp/internal/service"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxCalendarUploadSize limits uploaded .ics files to 10 MB.
+const maxCalendarUploadSize = 10 << 20
+
+func CreateCalendarImport(s *service.CalendarImportService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading create calendar import body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		calendarImport := &service.CreateCalendarImportRequest{}
+
+		err = json.Unmarshal(body, calendarImport)
+		if err != nil {
+			log.Printf("Error unmarshalling calendar import body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		calendarImport.GroupID = groupIDint
+
+		ctx := context.Background()
+
+		createdImport, err := s.CreateImport(calendarImport, ctx)
+		if err != nil {
+			log.Printf("Error creating calendar import: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		respBody, err := json.Marshal(createdImport)
+		if err != nil {
+			log.Printf("Error marshalling created calendar import response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func UploadCalendar(s *service.CalendarImportService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		uploadedImport, err := s.UploadCalendar(groupIDint, http.MaxBytesReader(w, r.Body, maxCalendarUploadSize), ctx)
+		if err != nil {
+			log.Printf("Error importing uploaded calendar: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(uploadedImport)
+		if err != nil {
+			log.Printf("Error marshalling uploaded calendar response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func GetCalendarImports(s *service.CalendarImportService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		imports, err := s.GetImports(groupIDint, ctx)
+		if err != nil {
+			log.Printf("Error fetching calendar imports: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(imports)
+		if err != nil {
+			log.Printf("Error marshalling get calendar imports response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
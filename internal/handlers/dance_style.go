@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github/eventApp/internal/service"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const danceStyleIDParam = "styleId"
+
+func CreateDanceStyle(s *service.DanceStyleService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading create dance style body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		style := &service.CreateDanceStyleRequest{}
+
+		err = json.Unmarshal(body, style)
+		if err != nil {
+			log.Printf("Error unmarshalling dance style body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		createdStyle, err := s.CreateDanceStyle(style, ctx)
+		if err != nil {
+			log.Printf("Error creating dance style: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(createdStyle)
+		if err != nil {
+			log.Printf("Error marshalling created dance style response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func UpdateDanceStyle(s *service.DanceStyleService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		styleID := p.ByName(danceStyleIDParam)
+		styleIDint, err := strconv.ParseInt(styleID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting dance style id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading update dance style body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		style := &service.UpdateDanceStyleRequest{}
+
+		err = json.Unmarshal(body, style)
+		if err != nil {
+			log.Printf("Error unmarshalling dance style body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		updatedStyle, err := s.UpdateDanceStyle(styleIDint, style, ctx)
+		if err != nil {
+			log.Printf("Error updating dance style: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(updatedStyle)
+		if err != nil {
+			log.Printf("Error marshalling updated dance style response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func DeleteDanceStyle(s *service.DanceStyleService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		styleID := p.ByName(danceStyleIDParam)
+		styleIDint, err := strconv.ParseInt(styleID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting dance style id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+
+		err = s.DeleteDanceStyle(styleIDint, ctx)
+		if err != nil {
+			log.Printf("Error deleting dance style: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetDanceStyles(s *service.DanceStyleService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		styles, err := s.GetDanceStyles(ctx)
+		if err != nil {
+			log.Printf("Error fetching dance styles: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody, err := json.Marshal(styles)
+		if err != nil {
+			log.Printf("Error marshalling get dance styles response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"errors"
+	"github/eventApp/internal/models"
+	"net/http"
+)
+
+// errorStatus is the status code a service error is answered with.
+func errorStatus(err error) int {
+	var invalid *models.ValidationError
+
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
@@ -3,17 +3,28 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github/eventApp/internal/service"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 const eventIDParam = "eventId"
 
+// detailParamPrefix prefixes the search params filtering by event details.
+const detailParamPrefix = "detail."
+
+// searchFallbackHeader is set on search results that came from Postgres
+// because Elasticsearch was unavailable.
+const searchFallbackHeader = "X-Search-Fallback"
+
 func CreateEvent(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -46,7 +57,7 @@ func CreateEvent(s *service.EventService) func(w http.ResponseWriter, r *http.Re
 		createdEvent, err := s.CreateEvent(event, ctx)
 		if err != nil {
 			log.Printf("Error creating event: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(errorStatus(err))
 			return
 		}
 
@@ -96,10 +107,10 @@ func UpdateEvent(s *service.EventService) func(w http.ResponseWriter, r *http.Re
 
 		event.GroupID = groupIDint
 
-		updatedEvent, err := s.UpdateEvent(eventIDint, event, ctx)
+		updatedEvent, err := s.UpdateEvent(groupIDint, eventIDint, event, ctx)
 		if err != nil {
 			log.Printf("Error updating event: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(errorStatus(err))
 			return
 		}
 
@@ -126,13 +137,38 @@ func GetEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Requ
 			log.Printf("Error converting group id param to int: %v", err)
 		}
 
-		events, err := s.GetEvents(groupIDint, ctx)
+		var from, to time.Time
+
+		if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+			from, err = time.Parse(time.RFC3339, fromParam)
+			if err != nil {
+				log.Printf("Error parsing from param: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if toParam := r.URL.Query().Get("to"); toParam != "" {
+			to, err = time.Parse(time.RFC3339, toParam)
+			if err != nil {
+				log.Printf("Error parsing to param: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := s.GetEvents(groupIDint, from, to, ctx)
 		if err != nil {
 			log.Printf("Error fetching events: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		if wantsGeoJSON(r) {
+			writeGeoJSON(w, service.NewEventFeatureCollection(events))
+			return
+		}
+
 		respBody, err := json.Marshal(events)
 		if err != nil {
 			log.Printf("Error marshalling get events response: %v", err)
@@ -144,42 +180,514 @@ func GetEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-func GetEventsByDistance(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func SearchEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 		ctx := context.Background()
 
-		lat := r.URL.Query().Get("lat")
-		latFloat64, err := strconv.ParseFloat(lat, 64)
+		// The location is optional when searching by text or area.
+		withArea := r.URL.Query().Has("region") || r.URL.Query().Has("polygon")
+		withLocation := (r.URL.Query().Get("q") == "" && !withArea) || r.URL.Query().Has("distance")
+
+		search, err := searchEventsParams(r, withLocation)
 		if err != nil {
-			log.Printf("Error converting latitude to float64: %v", err)
+			log.Printf("Error parsing search params: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		long := r.URL.Query().Get("long")
-		longFloat64, err := strconv.ParseFloat(long, 64)
+		if size := r.URL.Query().Get("size"); size != "" {
+			search.Size, err = strconv.Atoi(size)
+			if err != nil {
+				log.Printf("Error converting size to int: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		search.Cursor = r.URL.Query().Get("cursor")
+
+		events, err := s.SearchEvents(search, ctx)
 		if err != nil {
-			log.Printf("Error converting longitude to float64: %v", err)
+			log.Printf("Error searching events: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		if events.FromFallback {
+			w.Header().Set(searchFallbackHeader, "postgres")
+		}
+
+		if wantsGeoJSON(r) {
+			writeGeoJSON(w, events.FeatureCollection())
 			return
 		}
 
-		distance := r.URL.Query().Get("distance")
-		distanceFloat64, err := strconv.ParseFloat(distance, 64)
+		respBody, err := json.Marshal(events)
 		if err != nil {
-			log.Printf("Error converting latitude to float64: %v", err)
+			log.Printf("Error marshalling search events response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		events, err := s.GetEventsByDistance(latFloat64, longFloat64, distanceFloat64, ctx)
+		w.Write(respBody)
+	}
+}
+
+func GetMapEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		filters, err := searchEventsParams(r, false)
 		if err != nil {
-			log.Printf("Error fetching events: %v", err)
+			log.Printf("Error parsing search params: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		search := &service.MapEventsRequest{
+			Query:            filters.Query,
+			IncludeCancelled: filters.IncludeCancelled,
+			DanceStyles:      filters.DanceStyles,
+			Levels:           filters.Levels,
+			Types:            filters.Types,
+			From:             filters.From,
+			To:               filters.To,
+			MinLevel:         filters.MinLevel,
+			MaxLevel:         filters.MaxLevel,
+			Details:          filters.Details,
+		}
+
+		corners := []struct {
+			param string
+			value *float64
+		}{
+			{"topLeftLat", &search.Top},
+			{"topLeftLong", &search.Left},
+			{"bottomRightLat", &search.Bottom},
+			{"bottomRightLong", &search.Right},
+		}
+
+		for _, c := range corners {
+			*c.value, err = strconv.ParseFloat(r.URL.Query().Get(c.param), 64)
+			if err != nil {
+				log.Printf("Error converting %s to float64: %v", c.param, err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		search.Zoom, err = strconv.Atoi(r.URL.Query().Get("zoom"))
+		if err != nil {
+			log.Printf("Error converting zoom to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		events, err := s.GetMapEvents(search, ctx)
+		if err != nil {
+			log.Printf("Error searching map events: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		if events.FromFallback {
+			w.Header().Set(searchFallbackHeader, "postgres")
+		}
+
+		respBody, err := json.Marshal(events)
+		if err != nil {
+			log.Printf("Error marshalling map events response: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		w.Write(respBody)
+	}
+}
+
+// geoJSONContentType is the media type of RFC 7946 GeoJSON.
+const geoJSONContentType = "application/geo+json"
+
+func GetEventStats(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		filters, err := searchEventsParams(r, r.URL.Query().Has("distance"))
+		if err != nil {
+			log.Printf("Error parsing search params: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		stats, err := s.GetEventStats(&service.EventStatsRequest{
+			SearchEventsRequest: *filters,
+			Interval:            r.URL.Query().Get("interval"),
+		}, ctx)
+		if err != nil {
+			log.Printf("Error fetching event stats: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		if stats.FromFallback {
+			w.Header().Set(searchFallbackHeader, "postgres")
+		}
+
+		respBody, err := json.Marshal(stats)
+		if err != nil {
+			log.Printf("Error marshalling event stats response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func SuggestEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		suggestions, err := s.SuggestEvents(r.URL.Query().Get("prefix"), ctx)
+		if err != nil {
+			log.Printf("Error suggesting events: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if suggestions.FromFallback {
+			w.Header().Set(searchFallbackHeader, "postgres")
+		}
+
+		respBody, err := json.Marshal(suggestions)
+		if err != nil {
+			log.Printf("Error marshalling event suggestions response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+// mvtContentType is the media type of Mapbox vector tiles.
+const mvtContentType = "application/vnd.mapbox-vector-tile"
+
+func GetEventTile(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		// httprouter params span whole path segments, so the extension is
+		// part of the last one.
+		y, ok := strings.CutSuffix(p.ByName("tile"), ".mvt")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		filters, err := searchEventsParams(r, r.URL.Query().Has("distance"))
+		if err != nil {
+			log.Printf("Error parsing search params: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tile := &service.EventTileRequest{SearchEventsRequest: *filters}
+
+		coordinates := []struct {
+			value string
+			to    *int
+		}{
+			{p.ByName("z"), &tile.Z},
+			{p.ByName("x"), &tile.X},
+			{y, &tile.Y},
+		}
+
+		for _, c := range coordinates {
+			*c.to, err = strconv.Atoi(c.value)
+			if err != nil {
+				log.Printf("Error converting tile coordinate to int: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		resp, err := s.EventTile(tile, ctx)
+		if err != nil {
+			log.Printf("Error rendering event tile: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		if resp.FromFallback {
+			w.Header().Set(searchFallbackHeader, "postgres")
+		}
+
+		w.Header().Set("Content-Type", mvtContentType)
+		w.Write(resp.Tile)
+	}
+}
+
+// searchEventsParams reads the filters shared by the event search endpoints,
+// along with lat, long and distance when withLocation is set.
+func searchEventsParams(r *http.Request, withLocation bool) (*service.SearchEventsRequest, error) {
+	search := &service.SearchEventsRequest{
+		Query:       r.URL.Query().Get("q"),
+		DanceStyles: multiValueParam(r, "style"),
+		Levels:      multiValueParam(r, "level"),
+		Types:       multiValueParam(r, "type"),
+		Region:      r.URL.Query().Get("region"),
+		MinLevel:    r.URL.Query().Get("minLevel"),
+		MaxLevel:    r.URL.Query().Get("maxLevel"),
+	}
+
+	// Details are filtered by with detail.<field>, e.g. detail.teachers.
+	for param := range r.URL.Query() {
+		field, ok := strings.CutPrefix(param, detailParamPrefix)
+		names := multiValueParam(r, param)
+		if !ok || len(names) == 0 {
+			continue
+		}
+
+		if search.Details == nil {
+			search.Details = make(map[string][]string)
+		}
+		search.Details[field] = names
+	}
+
+	var err error
+
+	if polygon := r.URL.Query().Get("polygon"); polygon != "" {
+		search.Polygon, err = polygonParam(polygon)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if withLocation {
+		search.Latitude, err = strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("converting latitude to float64: %w", err)
+		}
+
+		search.Longitude, err = strconv.ParseFloat(r.URL.Query().Get("long"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("converting longitude to float64: %w", err)
+		}
+
+		search.Distance, err = strconv.ParseFloat(r.URL.Query().Get("distance"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("converting distance to float64: %w", err)
+		}
+	}
+
+	if ic := r.URL.Query().Get("includeCancelled"); ic != "" {
+		search.IncludeCancelled, err = strconv.ParseBool(ic)
+		if err != nil {
+			return nil, fmt.Errorf("converting includeCancelled to bool: %w", err)
+		}
+	}
+
+	if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+		search.From, err = time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return nil, fmt.Errorf("parsing from param: %w", err)
+		}
+	}
+
+	if toParam := r.URL.Query().Get("to"); toParam != "" {
+		search.To, err = time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return nil, fmt.Errorf("parsing to param: %w", err)
+		}
+	}
+
+	return search, nil
+}
+
+// polygonParam parses a polygon given as comma separated latitude, longitude
+// pairs.
+func polygonParam(polygon string) ([][2]float64, error) {
+	coordinates := strings.Split(polygon, ",")
+	if len(coordinates)%2 != 0 {
+		return nil, fmt.Errorf("polygon has an odd number of coordinates")
+	}
+
+	points := make([][2]float64, 0, len(coordinates)/2)
+	for i := 0; i < len(coordinates); i += 2 {
+		lat, err := strconv.ParseFloat(strings.TrimSpace(coordinates[i]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("converting polygon latitude to float64: %w", err)
+		}
+
+		long, err := strconv.ParseFloat(strings.TrimSpace(coordinates[i+1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("converting polygon longitude to float64: %w", err)
+		}
+
+		points = append(points, [2]float64{lat, long})
+	}
+
+	return points, nil
+}
+
+// wantsGeoJSON reports whether the client asked for a GeoJSON response, with
+// the format query parameter or the Accept header.
+func wantsGeoJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "geojson" {
+		return true
+	}
+
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == geoJSONContentType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func writeGeoJSON(w http.ResponseWriter, fc *service.EventFeatureCollectionResponse) {
+	respBody, err := json.Marshal(fc)
+	if err != nil {
+		log.Printf("Error marshalling feature collection: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", geoJSONContentType)
+	w.Write(respBody)
+}
+
+// multiValueParam accepts a query parameter both repeated and as a comma
+// separated list.
+func multiValueParam(r *http.Request, name string) []string {
+	var values []string
+
+	for _, param := range r.URL.Query()[name] {
+		for _, v := range strings.Split(param, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values
+}
+
+func GetSimilarEvents(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		events, err := s.GetSimilarEvents(groupIDint, eventIDint, ctx)
+		if err != nil {
+			log.Printf("Error fetching similar events: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
 		respBody, err := json.Marshal(events)
 		if err != nil {
-			log.Printf("Error marshalling get events response: %v", err)
+			log.Printf("Error marshalling similar events response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func DeleteEvent(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = s.DeleteEvent(groupIDint, eventIDint, ctx)
+		if err != nil {
+			log.Printf("Error deleting event: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// CancelEvent returns a handler that cancels the event when cancelled is true
+// and restores it otherwise.
+func CancelEvent(s *service.EventService, cancelled bool) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		event, err := s.CancelEvent(groupIDint, eventIDint, cancelled, ctx)
+		if err != nil {
+			log.Printf("Error cancelling event: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		respBody, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Error marshalling cancelled event response: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
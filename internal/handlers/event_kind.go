@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github/eventApp/internal/service"
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func GetEventKinds(s *service.EventService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		ctx := context.Background()
+
+		respBody, err := json.Marshal(s.GetEventKinds(ctx))
+		if err != nil {
+			log.Printf("Error marshalling get event kinds response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github/eventApp/internal/middleware"
+	"github/eventApp/internal/service"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// recurrenceIDParam reads the occurrence of a recurring event an RSVP
+// request is for, nil when it isn't given.
+func recurrenceIDParam(r *http.Request) (*time.Time, error) {
+	param := r.URL.Query().Get("recurrenceId")
+	if param == "" {
+		return nil, nil
+	}
+
+	recurrenceID, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recurrenceID, nil
+}
+
+func SetRSVP(s *service.RSVPService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := context.Background()
+
+		userID, ok := middleware.UserID(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading rsvp body: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rsvp := &service.SetRSVPRequest{}
+
+		err = json.Unmarshal(body, rsvp)
+		if err != nil {
+			log.Printf("Error unmarshalling rsvp body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rsvp.GroupID = groupIDint
+		rsvp.EventID = eventIDint
+		rsvp.UserID = userID
+
+		savedRSVP, err := s.SetRSVP(rsvp, ctx)
+		if err != nil {
+			log.Printf("Error saving rsvp: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		respBody, err := json.Marshal(savedRSVP)
+		if err != nil {
+			log.Printf("Error marshalling rsvp response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
+
+func RemoveRSVP(s *service.RSVPService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := context.Background()
+
+		userID, ok := middleware.UserID(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		recurrenceID, err := recurrenceIDParam(r)
+		if err != nil {
+			log.Printf("Error parsing recurrence id param: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rrr := &service.RemoveRSVPRequest{
+			GroupID:      groupIDint,
+			EventID:      eventIDint,
+			RecurrenceID: recurrenceID,
+			UserID:       userID,
+		}
+
+		err = s.RemoveRSVP(rrr, ctx)
+		if err != nil {
+			log.Printf("Error removing rsvp: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetRSVPs(s *service.RSVPService) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := context.Background()
+
+		groupID := p.ByName(groupIDParam)
+		groupIDint, err := strconv.ParseInt(groupID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting group id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		eventID := p.ByName(eventIDParam)
+		eventIDint, err := strconv.ParseInt(eventID, 10, 64)
+		if err != nil {
+			log.Printf("Error converting event id param to int: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		recurrenceID, err := recurrenceIDParam(r)
+		if err != nil {
+			log.Printf("Error parsing recurrence id param: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rsvps, err := s.GetRSVPs(groupIDint, eventIDint, recurrenceID, ctx)
+		if err != nil {
+			log.Printf("Error fetching rsvps: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+
+		respBody, err := json.Marshal(rsvps)
+		if err != nil {
+			log.Printf("Error marshalling get rsvps response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(respBody)
+	}
+}
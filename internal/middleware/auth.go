@@ -1,14 +1,27 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/julienschmidt/httprouter"
 )
 
+type contextKey string
+
+const userIDKey contextKey = "user_id"
+
+func UserID(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDKey).(int64)
+	return userID, ok
+}
+
 func Auth(jwtSecret string, next httprouter.Handle) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -41,12 +54,105 @@ func Auth(jwtSecret string, next httprouter.Handle) func(w http.ResponseWriter,
 			return
 		}
 
-		_, ok = claims["user_id"].(float64)
+		userID, ok := claims["user_id"].(float64)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, int64(userID))
+
+		next(w, r.WithContext(ctx), p)
+
+	}
+}
+
+type calendarTokenValidator interface {
+	GetUserIDByCalendarToken(token string, ctx context.Context) (int64, error)
+}
+
+// CalendarAuth authenticates calendar feeds with the per-user token in the
+// "token" query parameter, since calendar clients can't send Bearer headers.
+func CalendarAuth(ctv calendarTokenValidator, next httprouter.Handle) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := ctv.GetUserIDByCalendarToken(token, r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+
+		next(w, r.WithContext(ctx), p)
+
+	}
+}
+
+// Admin only lets through the users listed in adminIDs. It has to be wrapped
+// in Auth, which puts the user ID in the context.
+func Admin(adminIDs []int64, next httprouter.Handle) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		userID, ok := UserID(r.Context())
+		if !ok || !slices.Contains(adminIDs, userID) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next(w, r, p)
+
+	}
+}
+
+type groupMembershipChecker interface {
+	IsGroupMember(groupID, userID int64, ctx context.Context) (bool, error)
+}
+
+// GroupMember only lets through members of the group in the groupId route
+// parameter and the users listed in adminIDs. It has to be wrapped in Auth,
+// which puts the user ID in the context.
+func GroupMember(gmc groupMembershipChecker, adminIDs []int64, next httprouter.Handle) func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+		userID, ok := UserID(r.Context())
 		if !ok {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
+		if slices.Contains(adminIDs, userID) {
+			next(w, r, p)
+			return
+		}
+
+		groupID, err := strconv.ParseInt(p.ByName("groupId"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		member, err := gmc.IsGroupMember(groupID, userID, r.Context())
+		if err != nil {
+			log.Printf("Error checking group membership: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !member {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
 		next(w, r, p)
 
 	}
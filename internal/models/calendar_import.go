@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type CalendarImport struct {
+	ID           int64
+	GroupID      int64
+	URL          string
+	LastSyncedAt time.Time
+	LastError    string
+}
@@ -0,0 +1,14 @@
+package models
+
+// DanceStyle is a node of the managed dance style taxonomy. Events use the
+// canonical Name, Synonyms are other spellings normalized to it. A ParentID
+// of 0 makes it a top level style.
+type DanceStyle struct {
+	ID       int64
+	Name     string
+	ParentID int64
+	Synonyms []string
+	// Levels is the style's skill level scale, lowest first. Styles without
+	// one use their parent's.
+	Levels []string
+}
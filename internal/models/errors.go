@@ -0,0 +1,29 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is wrapped by errors about things that don't exist, or aren't
+// where they were looked for.
+var ErrNotFound = errors.New("not found")
+
+// ErrUnsupported is returned by search backends for queries they leave to the
+// caller, e.g. aggregations on backends without them.
+var ErrUnsupported = errors.New("unsupported by the search backend")
+
+// ValidationError is returned for requests that can't succeed as they are,
+// e.g. because of an invalid value.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Invalidf formats a ValidationError.
+func Invalidf(format string, args ...any) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
@@ -3,14 +3,61 @@ package models
 import "time"
 
 type Event struct {
-	ID          int64
-	Name        string
-	Time        time.Time
-	Latitude    float64
-	Longitude   float64
-	Location    string
-	GroupID     int64
-	DanceStyles []string
-	Type        string
-	Levels      []string
+	ID               int64
+	Name             string
+	Time             time.Time
+	Latitude         float64
+	Longitude        float64
+	Location         string
+	GroupID          int64
+	DanceStyles      []string
+	Type             string
+	Levels           []string
+	Details          *EventDetails
+	Capacity         int
+	MaxRoleImbalance int
+	Timezone         string
+	Recurrence       *Recurrence
+	Cancelled        bool
+	// MinLevel and MaxLevel are the positions of the lowest and highest of
+	// Levels on the level scale of the event's dance style, counting from 1.
+	// Both are 0 for events without levels.
+	MinLevel int
+	MaxLevel int
+	// RecurrenceID is the original start of an expanded occurrence of a
+	// recurring event, nil for the series itself and for one-off events.
+	RecurrenceID *time.Time
+	// ImportID and ExternalUID link events created from an external
+	// iCalendar feed back to the feed and the VEVENT UID.
+	ImportID    int64
+	ExternalUID string
+	// GroupKeyWords are the owning group's keywords, loaded along with the
+	// event for the search index.
+	GroupKeyWords []string
+}
+
+// EventDetails are the fields specific to the event's type, which of them
+// an event can or has to have depends on the type.
+type EventDetails struct {
+	EndTime       *time.Time
+	Teachers      []string
+	Prerequisites []string
+	DJs           []string
+	Artists       []string
+	Performers    []string
+}
+
+type Recurrence struct {
+	RRule     string
+	ExDates   []time.Time
+	Overrides []OccurrenceOverride
+}
+
+type OccurrenceOverride struct {
+	RecurrenceID time.Time
+	Name         *string
+	Time         *time.Time
+	Location     *string
+	Latitude     *float64
+	Longitude    *float64
 }
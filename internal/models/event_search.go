@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// EventSearchFilter narrows an event search. Empty fields don't filter,
+// several values of one dimension match events having any of them. The
+// location only filters when Distance is set.
+type EventSearchFilter struct {
+	Query       string
+	Latitude    float64
+	Longitude   float64
+	Distance    float64
+	BoundingBox *BoundingBox
+	// Area limits the search to events inside any of the polygons.
+	Area             []Polygon
+	IncludeCancelled bool
+	DanceStyles      []string
+	Levels           []string
+	Types            []string
+	From             time.Time
+	To               time.Time
+	// MinLevel and MaxLevel limit the search to events whose levels overlap
+	// the range, 0 leaves that end open.
+	MinLevel int
+	MaxLevel int
+	// Details maps event detail fields holding lists of names to the
+	// names to look for.
+	Details map[string][]string
+	// Size is the page size and After the sort values of the last event of
+	// the previous page.
+	Size  int
+	After []any
+	// Distinct returns a single hit per event, its first matching
+	// occurrence, instead of one per occurrence.
+	Distinct bool
+}
+
+// BoundingBox is a map viewport. Left is greater than Right when it crosses
+// the antimeridian.
+type BoundingBox struct {
+	Top    float64
+	Left   float64
+	Bottom float64
+	Right  float64
+}
+
+// EventCluster groups the events in a map tile, keyed "zoom/x/y".
+type EventCluster struct {
+	Key       string
+	Count     int
+	Latitude  float64
+	Longitude float64
+}
+
+type EventSearchResult struct {
+	Total int
+	Hits  []*EventSearchHit
+	// Facets is nil when the backend left facet and time filtering to the
+	// caller and Hits holds every matching event as a series.
+	Facets *EventFacets
+}
+
+type EventSearchHit struct {
+	Event *Event
+	// Highlights holds the fragments of each field matching the text query.
+	Highlights map[string][]string
+	// Sort holds the values the hit was sorted by, to page after it.
+	Sort []any
+}
+
+// EventFacets counts the matching events per value of each dimension,
+// ignoring the filter on that dimension itself so other values can be added.
+type EventFacets struct {
+	DanceStyles []FacetCount
+	Levels      []FacetCount
+	Types       []FacetCount
+}
+
+type FacetCount struct {
+	Value string
+	Count int
+}
+
+// EventSuggestions complete a search prefix, grouped by what they complete.
+type EventSuggestions struct {
+	Names       []string
+	Locations   []string
+	DanceStyles []string
+}
+
+// EventStats counts matching occurrences. Weekdays and hours are local to
+// each event's time zone.
+type EventStats struct {
+	Total       int
+	DanceStyles []FacetCount
+	Levels      []FacetCount
+	Types       []FacetCount
+	Weekdays    [7]int
+	Hours       [24]int
+	Histogram   []DateCount
+}
+
+// DateCount counts the occurrences in the interval starting at Start.
+type DateCount struct {
+	Start time.Time
+	Count int
+}
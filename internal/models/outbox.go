@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// OutboxEntry records that an event changed in Postgres and has to be synced
+// to the search index.
+type OutboxEntry struct {
+	ID            int64
+	EventID       int64
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	DeadAt        time.Time
+	ProcessedAt   time.Time
+}
+
+type OutboxStats struct {
+	Pending         int
+	Retrying        int
+	Dead            int
+	OldestPendingAt time.Time
+}
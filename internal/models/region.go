@@ -0,0 +1,17 @@
+package models
+
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Polygon is an outer ring followed by its holes. Rings are closed, the last
+// point repeats the first.
+type Polygon [][]GeoPoint
+
+// Region is a named area such as a city district, made of one or more
+// polygons.
+type Region struct {
+	Name     string
+	Polygons []Polygon
+}
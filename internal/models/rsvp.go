@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+	RSVPGoing      = "going"
+	RSVPInterested = "interested"
+	RSVPNotGoing   = "not_going"
+	RSVPWaitlisted = "waitlisted"
+)
+
+const (
+	RoleLead   = "lead"
+	RoleFollow = "follow"
+	RoleBoth   = "both"
+)
+
+type RSVP struct {
+	EventID int64
+	// RecurrenceID is the original start of the occurrence answered for,
+	// each occurrence of a recurring event has its own seats and waitlist.
+	// It is nil for one-off events.
+	RecurrenceID *time.Time
+	UserID       int64
+	Status       string
+	Role         string
+	UpdatedAt    time.Time
+}
+
+// OccurrenceKey identifies an occurrence of an event by its original start in
+// UTC, the zero time for one-off events.
+type OccurrenceKey struct {
+	EventID      int64
+	RecurrenceID time.Time
+}
+
+type RSVPCounts struct {
+	Going        int
+	GoingLeads   int
+	GoingFollows int
+	GoingBoth    int
+	Interested   int
+	NotGoing     int
+	Waitlisted   int
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type CalendarImportRepository struct {
+	db *bun.DB
+}
+
+type CalendarImport struct {
+	bun.BaseModel `bun:"table:calendar_imports,alias:ci"`
+
+	ID           int64     `bun:",pk,autoincrement,nullzero"`
+	GroupID      int64     `bun:",notnull"`
+	URL          string    `bun:",nullzero"`
+	LastSyncedAt time.Time `bun:",nullzero"`
+	LastError    string
+}
+
+func NewCalendarImportRepository(db *bun.DB, ctx context.Context) (*CalendarImportRepository, error) {
+	cir := &CalendarImportRepository{db}
+	err := cir.createCalendarImportTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cir, nil
+}
+
+func (s *CalendarImportRepository) createCalendarImportTable(ctx context.Context) error {
+	_, err := s.db.NewCreateTable().IfNotExists().Model((*CalendarImport)(nil)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (ci *CalendarImport) toModel() *models.CalendarImport {
+	return &models.CalendarImport{
+		ID:           ci.ID,
+		GroupID:      ci.GroupID,
+		URL:          ci.URL,
+		LastSyncedAt: ci.LastSyncedAt,
+		LastError:    ci.LastError,
+	}
+}
+
+func (s *CalendarImportRepository) CreateImport(calendarImport *models.CalendarImport, ctx context.Context) (*models.CalendarImport, error) {
+
+	ci := &CalendarImport{
+		GroupID: calendarImport.GroupID,
+		URL:     calendarImport.URL,
+	}
+
+	createdImport := &CalendarImport{}
+
+	err := s.db.NewInsert().Model(ci).Returning("*").Scan(ctx, createdImport)
+	if err != nil {
+		return nil, err
+	}
+
+	return createdImport.toModel(), nil
+}
+
+func (s *CalendarImportRepository) GetImports(groupID int64, ctx context.Context) ([]*models.CalendarImport, error) {
+	var imports []CalendarImport
+
+	err := s.db.NewSelect().Model(&imports).Where("group_id = ?", groupID).Order("id ASC").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mis := make([]*models.CalendarImport, 0, len(imports))
+
+	for _, ci := range imports {
+		mis = append(mis, ci.toModel())
+	}
+
+	return mis, nil
+}
+
+// GetURLImports returns the imports that are synced periodically, leaving out
+// one-off file uploads.
+func (s *CalendarImportRepository) GetURLImports(ctx context.Context) ([]*models.CalendarImport, error) {
+	var imports []CalendarImport
+
+	err := s.db.NewSelect().Model(&imports).Where("url IS NOT NULL").Order("id ASC").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mis := make([]*models.CalendarImport, 0, len(imports))
+
+	for _, ci := range imports {
+		mis = append(mis, ci.toModel())
+	}
+
+	return mis, nil
+}
+
+func (s *CalendarImportRepository) MarkSynced(id int64, syncErr string, ctx context.Context) error {
+	_, err := s.db.NewUpdate().
+		Model((*CalendarImport)(nil)).
+		Set("last_synced_at = ?", time.Now()).
+		Set("last_error = ?", syncErr).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+
+	"github.com/uptrace/bun"
+)
+
+type DanceStyleRepository struct {
+	db *bun.DB
+}
+
+type DanceStyle struct {
+	bun.BaseModel `bun:"table:dance_styles,alias:u"`
+
+	ID       int64  `bun:",pk,autoincrement,nullzero"`
+	Name     string `bun:",unique,notnull"`
+	ParentID int64  `bun:",nullzero"`
+	Synonyms []string
+	Levels   []string
+}
+
+func (d *DanceStyle) toModel() *models.DanceStyle {
+	return &models.DanceStyle{
+		ID:       d.ID,
+		Name:     d.Name,
+		ParentID: d.ParentID,
+		Synonyms: d.Synonyms,
+		Levels:   d.Levels,
+	}
+}
+
+func NewDanceStyleRepository(db *bun.DB, ctx context.Context) (*DanceStyleRepository, error) {
+	dsr := &DanceStyleRepository{db}
+	err := dsr.createDanceStyleTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dsr, nil
+}
+
+func (s *DanceStyleRepository) createDanceStyleTable(ctx context.Context) error {
+	_, err := s.db.NewCreateTable().IfNotExists().Model((*DanceStyle)(nil)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE dance_styles ADD COLUMN IF NOT EXISTS levels jsonb")
+	return err
+}
+
+func (s *DanceStyleRepository) CreateDanceStyle(style *models.DanceStyle, ctx context.Context) (*models.DanceStyle, error) {
+	ds := &DanceStyle{
+		Name:     style.Name,
+		ParentID: style.ParentID,
+		Synonyms: style.Synonyms,
+		Levels:   style.Levels,
+	}
+
+	createdStyle := &DanceStyle{}
+
+	err := s.db.NewInsert().Model(ds).Returning("*").Scan(ctx, createdStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return createdStyle.toModel(), nil
+}
+
+func (s *DanceStyleRepository) UpdateDanceStyle(id int64, style *models.DanceStyle, ctx context.Context) (*models.DanceStyle, error) {
+	ds := &DanceStyle{
+		Name:     style.Name,
+		ParentID: style.ParentID,
+		Synonyms: style.Synonyms,
+		Levels:   style.Levels,
+	}
+
+	updatedStyle := &DanceStyle{}
+
+	err := s.db.NewUpdate().Model(ds).Column("name", "parent_id", "synonyms", "levels").Where("id = ?", id).Returning("*").Scan(ctx, updatedStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedStyle.toModel(), nil
+}
+
+func (s *DanceStyleRepository) DeleteDanceStyle(id int64, ctx context.Context) error {
+	_, err := s.db.NewDelete().Model((*DanceStyle)(nil)).Where("id = ?", id).Exec(ctx)
+	return err
+}
+
+func (s *DanceStyleRepository) GetDanceStyles(ctx context.Context) ([]*models.DanceStyle, error) {
+	var styles []DanceStyle
+
+	err := s.db.NewSelect().Model(&styles).Order("name").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mss := make([]*models.DanceStyle, 0, len(styles))
+	for _, ds := range styles {
+		mss = append(mss, ds.toModel())
+	}
+
+	return mss, nil
+}
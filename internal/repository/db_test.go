@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// testDB connects to the Postgres database in TEST_DATABASE_URL and creates
+// the tables the repositories share. Tests needing a database are skipped
+// without it.
+func testDB(t *testing.T) *bun.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is needed for database tests")
+	}
+
+	ctx := context.Background()
+
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+
+	_, err := NewGroupRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating group repository: %v", err)
+	}
+
+	_, err = NewOutboxRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating outbox repository: %v", err)
+	}
+
+	return db
+}
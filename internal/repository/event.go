@@ -2,10 +2,15 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"github/eventApp/internal/models"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
 type EventRepository struct {
@@ -15,16 +20,85 @@ type EventRepository struct {
 type Event struct {
 	bun.BaseModel `bun:"table:events,alias:u"`
 
-	ID          int64     `bun:",pk,autoincrement,nullzero"`
-	GroupID     int64     `bun:",notnull"`
-	Name        string    `bun:",notnull"`
-	Time        time.Time `bun:"time,notnull"`
-	Location    string    `bun:",notnull"`
-	Latitude    float64   `bun:",notnull"`
-	Longitude   float64   `bun:",notnull"`
-	DanceStyles []string
-	Type        string
-	Levels      []string
+	ID               int64     `bun:",pk,autoincrement,nullzero"`
+	GroupID          int64     `bun:",notnull"`
+	Name             string    `bun:",notnull"`
+	Time             time.Time `bun:"time,notnull"`
+	Location         string    `bun:",notnull"`
+	Latitude         float64   `bun:",notnull"`
+	Longitude        float64   `bun:",notnull"`
+	DanceStyles      []string
+	Type             string
+	Levels           []string
+	Details          *EventDetails `bun:"type:jsonb"`
+	MinLevel         int
+	MaxLevel         int
+	Capacity         int
+	MaxRoleImbalance int
+	Timezone         string
+	Recurrence       *Recurrence `bun:"type:jsonb"`
+	Cancelled        bool        `bun:",notnull,default:false"`
+	ImportID         int64       `bun:",nullzero"`
+	ExternalUID      string      `bun:",nullzero"`
+	Group            *Group      `bun:"rel:belongs-to,join:group_id=id"`
+}
+
+// EventDetails is stored as JSON in Postgres and indexed as is in
+// Elasticsearch.
+type EventDetails struct {
+	EndTime       *time.Time `json:"endTime,omitempty"`
+	Teachers      []string   `json:"teachers,omitempty"`
+	Prerequisites []string   `json:"prerequisites,omitempty"`
+	DJs           []string   `json:"djs,omitempty"`
+	Artists       []string   `json:"artists,omitempty"`
+	Performers    []string   `json:"performers,omitempty"`
+}
+
+func newEventDetails(details *models.EventDetails) *EventDetails {
+	if details == nil {
+		return nil
+	}
+
+	d := EventDetails(*details)
+	return &d
+}
+
+func (d *EventDetails) toModel() *models.EventDetails {
+	if d == nil {
+		return nil
+	}
+
+	md := models.EventDetails(*d)
+	return &md
+}
+
+type Recurrence struct {
+	RRule     string               `json:"rrule"`
+	ExDates   []time.Time          `json:"exDates,omitempty"`
+	Overrides []OccurrenceOverride `json:"overrides,omitempty"`
+}
+
+type OccurrenceOverride struct {
+	RecurrenceID time.Time  `json:"recurrenceId"`
+	Name         *string    `json:"name,omitempty"`
+	Time         *time.Time `json:"time,omitempty"`
+	Location     *string    `json:"location,omitempty"`
+	Latitude     *float64   `json:"latitude,omitempty"`
+	Longitude    *float64   `json:"longitude,omitempty"`
+}
+
+// eventColumns are added to tables created before the columns existed.
+var eventColumns = []string{
+	"capacity bigint",
+	"max_role_imbalance bigint",
+	"timezone varchar",
+	"recurrence jsonb",
+	"import_id bigint",
+	"external_uid varchar",
+	"cancelled boolean NOT NULL DEFAULT false",
+	"min_level bigint",
+	"max_level bigint",
+	"details jsonb",
 }
 
 func NewEventRepository(db *bun.DB, ctx context.Context) (*EventRepository, error) {
@@ -42,81 +116,158 @@ func (s *EventRepository) createEventTable(ctx context.Context) error {
 		return err
 	}
 
+	for _, column := range eventColumns {
+		_, err = s.db.ExecContext(ctx, "ALTER TABLE events ADD COLUMN IF NOT EXISTS "+column)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *EventRepository) CreateEvent(event *models.Event, ctx context.Context) (*models.Event, error) {
-
+func newEvent(event *models.Event) *Event {
 	e := &Event{
-		Name:        event.Name,
-		GroupID:     event.GroupID,
-		Time:        event.Time,
-		Latitude:    event.Latitude,
-		Longitude:   event.Longitude,
-		Location:    event.Location,
-		DanceStyles: event.DanceStyles,
-		Type:        event.Type,
-		Levels:      event.Levels,
+		Name:             event.Name,
+		GroupID:          event.GroupID,
+		Time:             event.Time,
+		Latitude:         event.Latitude,
+		Longitude:        event.Longitude,
+		Location:         event.Location,
+		DanceStyles:      event.DanceStyles,
+		Type:             event.Type,
+		Levels:           event.Levels,
+		Details:          newEventDetails(event.Details),
+		MinLevel:         event.MinLevel,
+		MaxLevel:         event.MaxLevel,
+		Capacity:         event.Capacity,
+		MaxRoleImbalance: event.MaxRoleImbalance,
+		Timezone:         event.Timezone,
+		ImportID:         event.ImportID,
+		ExternalUID:      event.ExternalUID,
+	}
+
+	if event.Recurrence != nil {
+		e.Recurrence = &Recurrence{
+			RRule:   event.Recurrence.RRule,
+			ExDates: event.Recurrence.ExDates,
+		}
+
+		for _, o := range event.Recurrence.Overrides {
+			e.Recurrence.Overrides = append(e.Recurrence.Overrides, OccurrenceOverride(o))
+		}
+	}
+
+	return e
+}
+
+func (e *Event) toModel() *models.Event {
+	me := &models.Event{
+		ID:               e.ID,
+		Name:             e.Name,
+		GroupID:          e.GroupID,
+		Time:             e.Time,
+		Latitude:         e.Latitude,
+		Longitude:        e.Longitude,
+		Location:         e.Location,
+		DanceStyles:      e.DanceStyles,
+		Type:             e.Type,
+		Levels:           e.Levels,
+		Details:          e.Details.toModel(),
+		MinLevel:         e.MinLevel,
+		MaxLevel:         e.MaxLevel,
+		Capacity:         e.Capacity,
+		MaxRoleImbalance: e.MaxRoleImbalance,
+		Timezone:         e.Timezone,
+		Cancelled:        e.Cancelled,
+		ImportID:         e.ImportID,
+		ExternalUID:      e.ExternalUID,
 	}
 
+	if e.Group != nil {
+		me.GroupKeyWords = e.Group.KeyWords
+	}
+
+	if e.Recurrence != nil {
+		me.Recurrence = &models.Recurrence{
+			RRule:   e.Recurrence.RRule,
+			ExDates: e.Recurrence.ExDates,
+		}
+
+		for _, o := range e.Recurrence.Overrides {
+			me.Recurrence.Overrides = append(me.Recurrence.Overrides, models.OccurrenceOverride(o))
+		}
+	}
+
+	return me
+}
+
+func (s *EventRepository) CreateEvent(event *models.Event, ctx context.Context) (*models.Event, error) {
+
+	e := newEvent(event)
+
 	createdEvent := &Event{}
 
-	err := s.db.NewInsert().Model(e).Returning("*").Scan(ctx, createdEvent)
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewInsert().Model(e).Returning("*").Scan(ctx, createdEvent)
+		if err != nil {
+			return err
+		}
+
+		return enqueueSearchSync(tx, createdEvent.ID, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	ce := &models.Event{
-		ID:          createdEvent.ID,
-		Name:        createdEvent.Name,
-		GroupID:     createdEvent.GroupID,
-		Time:        createdEvent.Time,
-		Latitude:    createdEvent.Latitude,
-		Longitude:   createdEvent.Longitude,
-		Location:    createdEvent.Location,
-		DanceStyles: createdEvent.DanceStyles,
-		Type:        createdEvent.Type,
-		Levels:      createdEvent.Levels,
-	}
-
-	return ce, nil
+	return createdEvent.toModel(), nil
 }
 
 func (s *EventRepository) UpdateEvent(id int64, event *models.Event, ctx context.Context) (*models.Event, error) {
 
-	e := &Event{
-		Name:        event.Name,
-		GroupID:     event.GroupID,
-		Time:        event.Time,
-		Latitude:    event.Latitude,
-		Longitude:   event.Longitude,
-		Location:    event.Location,
-		DanceStyles: event.DanceStyles,
-		Type:        event.Type,
-		Levels:      event.Levels,
-	}
+	e := newEvent(event)
 
 	updatedEvent := &Event{}
 
-	err := s.db.NewUpdate().Model(e).Where("id = ?", id).Returning("*").Scan(ctx, updatedEvent)
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// The import link is only set on creation, so editing an imported event
+		// doesn't detach it from its feed, and cancelling has its own method.
+		err := tx.NewUpdate().Model(e).ExcludeColumn("id", "import_id", "external_uid", "cancelled").Where("id = ?", id).Returning("*").Scan(ctx, updatedEvent)
+		if err != nil {
+			return err
+		}
+
+		// A raised capacity or role imbalance frees seats, which go to the
+		// waitlist before the row lock is released and anyone else can
+		// RSVP.
+		limits, err := lockEventLimits(tx, id, ctx)
+		if err != nil {
+			return err
+		}
+
+		err = promoteWaitlists(tx, id, limits, ctx)
+		if err != nil {
+			return err
+		}
+
+		return enqueueSearchSync(tx, id, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	ue := &models.Event{
-		ID:          updatedEvent.ID,
-		Name:        updatedEvent.Name,
-		GroupID:     updatedEvent.GroupID,
-		Time:        updatedEvent.Time,
-		Latitude:    updatedEvent.Latitude,
-		Longitude:   updatedEvent.Longitude,
-		Location:    updatedEvent.Location,
-		DanceStyles: updatedEvent.DanceStyles,
-		Type:        updatedEvent.Type,
-		Levels:      updatedEvent.Levels,
+	return updatedEvent.toModel(), nil
+}
+
+func (s *EventRepository) GetEvent(id int64, ctx context.Context) (*models.Event, error) {
+	event := &Event{}
+
+	err := s.db.NewSelect().Model(event).Relation("Group").Where("u.id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return ue, nil
+	return event.toModel(), nil
 }
 
 func (s *EventRepository) GetEvents(groupID int64, ctx context.Context) ([]*models.Event, error) {
@@ -130,19 +281,309 @@ func (s *EventRepository) GetEvents(groupID int64, ctx context.Context) ([]*mode
 	mgs := make([]*models.Event, 0, len(events))
 
 	for _, e := range events {
-		mgs = append(mgs, &models.Event{
-			ID:          e.ID,
-			Name:        e.Name,
-			GroupID:     e.GroupID,
-			Time:        e.Time,
-			Latitude:    e.Latitude,
-			Longitude:   e.Longitude,
-			Location:    e.Location,
-			DanceStyles: e.DanceStyles,
-			Type:        e.Type,
-			Levels:      e.Levels,
-		})
+		mgs = append(mgs, e.toModel())
+	}
+
+	return mgs, nil
+}
+
+// GetEventsForUser returns the events of the user's groups and the events the
+// user has answered going, interested or waitlisted to.
+func (s *EventRepository) GetEventsForUser(userID int64, ctx context.Context) ([]*models.Event, error) {
+	var events []Event
+
+	groupIDs := s.db.NewSelect().Model((*GroupToUser)(nil)).Column("group_id").Where("user_id = ?", userID)
+	eventIDs := s.db.NewSelect().
+		Model((*RSVP)(nil)).
+		Column("event_id").
+		Where("user_id = ?", userID).
+		Where("status IN (?)", bun.In([]string{models.RSVPGoing, models.RSVPInterested, models.RSVPWaitlisted}))
+
+	err := s.db.NewSelect().
+		Model(&events).
+		WhereOr("group_id IN (?)", groupIDs).
+		WhereOr("id IN (?)", eventIDs).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mgs := make([]*models.Event, 0, len(events))
+
+	for _, e := range events {
+		mgs = append(mgs, e.toModel())
 	}
 
 	return mgs, nil
 }
+
+func (s *EventRepository) GetEventsByImport(importID int64, ctx context.Context) ([]*models.Event, error) {
+	var events []Event
+
+	err := s.db.NewSelect().Model(&events).Where("import_id = ?", importID).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mgs := make([]*models.Event, 0, len(events))
+
+	for _, e := range events {
+		mgs = append(mgs, e.toModel())
+	}
+
+	return mgs, nil
+}
+
+func (s *EventRepository) DeleteEvent(id int64, ctx context.Context) error {
+	return s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().Model((*RSVP)(nil)).Where("event_id = ?", id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().Model((*Event)(nil)).Where("id = ?", id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		return enqueueSearchSync(tx, id, ctx)
+	})
+}
+
+func (s *EventRepository) SetCancelled(id int64, cancelled bool, ctx context.Context) (*models.Event, error) {
+	updatedEvent := &Event{}
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().Model((*Event)(nil)).Set("cancelled = ?", cancelled).Where("id = ?", id).Returning("*").Scan(ctx, updatedEvent)
+		if err != nil {
+			return err
+		}
+
+		return enqueueSearchSync(tx, id, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedEvent.toModel(), nil
+}
+
+func (s *EventRepository) GetAllEvents(ctx context.Context) ([]*models.Event, error) {
+	var events []Event
+
+	err := s.db.NewSelect().Model(&events).Relation("Group").Order("u.id ASC").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mgs := make([]*models.Event, 0, len(events))
+
+	for _, e := range events {
+		mgs = append(mgs, e.toModel())
+	}
+
+	return mgs, nil
+}
+
+// earthRadiusKm is the mean radius used for haversine distances.
+const earthRadiusKm = 6371.0
+
+// GetEventsNear returns the events within distance kilometres without any
+// extension: a bounding box on the coordinates narrows the rows down, a
+// haversine distance then drops the ones in its corners. Like the Postgres
+// search backend, it returns recurring events as series and leaves time and
+// facet filtering to the caller.
+func (s *EventRepository) GetEventsNear(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	var events []Event
+
+	lat, long, distance := filter.Latitude, filter.Longitude, filter.Distance
+
+	query := textFilter(s.db.NewSelect().Model(&events), filter.Query)
+	query = boundingBoxFilter(query, filter.BoundingBox)
+	query = areaFilter(query, filter.Area)
+	query = levelFilter(query, filter.MinLevel, filter.MaxLevel)
+	query = detailsFilter(query, filter.Details)
+
+	if distance > 0 {
+		latDelta := distance / earthRadiusKm * 180 / math.Pi
+
+		query = query.
+			Where("latitude BETWEEN ? AND ?", lat-latDelta, lat+latDelta).
+			Where(`? * 2 * asin(sqrt(
+				power(sin(radians(latitude - ?) / 2), 2) +
+				cos(radians(?)) * cos(radians(latitude)) * power(sin(radians(longitude - ?) / 2), 2)
+			)) <= ?`, earthRadiusKm, lat, lat, long, distance)
+
+		// Near the poles or across the antimeridian the longitude range
+		// wraps, so only the haversine check is applied.
+		cosLat := math.Cos(lat * math.Pi / 180)
+		if cosLat > 0.01 {
+			longDelta := latDelta / cosLat
+			if long-longDelta >= -180 && long+longDelta <= 180 {
+				query = query.Where("longitude BETWEEN ? AND ?", long-longDelta, long+longDelta)
+			}
+		}
+	}
+
+	if !filter.IncludeCancelled {
+		query = query.Where("NOT cancelled")
+	}
+
+	err := query.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.EventSearchResult{Hits: make([]*models.EventSearchHit, 0, len(events))}
+
+	for _, e := range events {
+		result.Hits = append(result.Hits, &models.EventSearchHit{Event: e.toModel()})
+	}
+
+	return result, nil
+}
+
+// textFilter narrows a search to events whose name, location or group
+// keywords contain every word of q, ignoring case. It's the Postgres stand-in
+// for the fuzzy full-text query of the search index.
+func textFilter(query *bun.SelectQuery, q string) *bun.SelectQuery {
+	for _, word := range strings.Fields(q) {
+		pattern := "%" + likeEscaper.Replace(word) + "%"
+
+		query = query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				WhereOr("u.name ILIKE ?", pattern).
+				WhereOr("u.location ILIKE ?", pattern).
+				WhereOr("EXISTS (SELECT 1 FROM groups AS g WHERE g.id = u.group_id AND g.key_words::text ILIKE ?)", pattern)
+		})
+	}
+
+	return query
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetSuggestions completes prefix from the events table when the search
+// backend is unavailable.
+func (s *EventRepository) GetSuggestions(prefix string, size int, ctx context.Context) (*models.EventSuggestions, error) {
+	return suggestions(s.db, prefix, size, ctx)
+}
+
+// suggestions completes prefix to the most common event names, locations and
+// dance styles starting with it. Unlike the search index it doesn't tolerate
+// typos.
+func suggestions(db bun.IDB, prefix string, size int, ctx context.Context) (*models.EventSuggestions, error) {
+	pattern := likeEscaper.Replace(prefix) + "%"
+	result := &models.EventSuggestions{}
+
+	columns := []struct {
+		expr   string
+		values *[]string
+	}{
+		{"name", &result.Names},
+		{"location", &result.Locations},
+		{"jsonb_array_elements_text(dance_styles)", &result.DanceStyles},
+	}
+
+	for _, c := range columns {
+		*c.values = []string{}
+
+		err := db.NewRaw(
+			"SELECT value FROM (SELECT "+c.expr+" AS value FROM events WHERE NOT cancelled) AS v "+
+				"WHERE value ILIKE ? GROUP BY value ORDER BY count(*) DESC, value LIMIT ?",
+			pattern, size,
+		).Scan(ctx, c.values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// areaFilter narrows a search to events inside any of the polygons and outside
+// of their holes.
+func areaFilter(query *bun.SelectQuery, area []models.Polygon) *bun.SelectQuery {
+	if len(area) == 0 {
+		return query
+	}
+
+	return query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		for _, polygon := range area {
+			conditions := make([]string, 0, len(polygon))
+			args := make([]any, 0, len(polygon))
+			for i, ring := range polygon {
+				condition := "?::polygon @> point(u.longitude, u.latitude)"
+				if i > 0 {
+					condition = "NOT " + condition
+				}
+				conditions = append(conditions, condition)
+				args = append(args, polygonLiteral(ring))
+			}
+
+			q = q.WhereOr("("+strings.Join(conditions, " AND ")+")", args...)
+		}
+		return q
+	})
+}
+
+// polygonLiteral formats a ring as a Postgres polygon, x being the longitude.
+func polygonLiteral(ring []models.GeoPoint) string {
+	points := make([]string, 0, len(ring))
+	for _, p := range ring {
+		points = append(points, fmt.Sprintf("(%g,%g)", p.Longitude, p.Latitude))
+	}
+	return "(" + strings.Join(points, ",") + ")"
+}
+
+// levelFilter narrows a search to events whose levels overlap a level range,
+// events without levels never do.
+func levelFilter(query *bun.SelectQuery, minLevel, maxLevel int) *bun.SelectQuery {
+	if minLevel > 0 {
+		query = query.Where("u.max_level >= ?", minLevel)
+	}
+
+	if maxLevel > 0 {
+		query = query.Where("u.min_level BETWEEN 1 AND ?", maxLevel)
+	}
+
+	return query
+}
+
+// detailsFilter narrows a search to events with any of the names in each of
+// the detail fields.
+func detailsFilter(query *bun.SelectQuery, details map[string][]string) *bun.SelectQuery {
+	for _, field := range detailFields(details) {
+		query = query.Where("jsonb_exists_any(u.details->?, ?)", field, pgdialect.Array(details[field]))
+	}
+
+	return query
+}
+
+// detailFields are the detail fields searched for in order, so queries are
+// the same every time.
+func detailFields(details map[string][]string) []string {
+	fields := make([]string, 0, len(details))
+	for field := range details {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// boundingBoxFilter narrows a search to events inside a map viewport.
+func boundingBoxFilter(query *bun.SelectQuery, bbox *models.BoundingBox) *bun.SelectQuery {
+	if bbox == nil {
+		return query
+	}
+
+	query = query.Where("u.latitude BETWEEN ? AND ?", bbox.Bottom, bbox.Top)
+
+	if bbox.Left <= bbox.Right {
+		return query.Where("u.longitude BETWEEN ? AND ?", bbox.Left, bbox.Right)
+	}
+
+	return query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.WhereOr("u.longitude >= ?", bbox.Left).WhereOr("u.longitude <= ?", bbox.Right)
+	})
+}
@@ -3,30 +3,58 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github/eventApp/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/scroll"
+	searchapi "github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/distanceunit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/functionboostmode"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/functionscoremode"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/geoshaperelation"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 )
 
+// index is the alias searched and written through. It points at a versioned
+// index, so the events can be reindexed with new mappings and swapped in.
 const index = "events"
 
 type EventSearchRepository struct {
-	es *elasticsearch.TypedClient
+	es           *elasticsearch.TypedClient
+	indicesReady atomic.Bool
 }
 
 type EventSearch struct {
-	ID          int64     `json:"id"`
-	GroupID     int64     `json:"groupId"`
-	Name        string    `json:"name"`
-	Time        time.Time `json:"time"`
-	Location    string    `json:"location"`
-	LocationGeo GeoPoint  `json:"locationGeo"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	ID               int64      `json:"id"`
+	GroupID          int64      `json:"groupId"`
+	Name             string     `json:"name"`
+	Time             time.Time  `json:"time"`
+	Location         string     `json:"location"`
+	LocationGeo      GeoPoint   `json:"locationGeo"`
+	DanceStyles      []string   `json:"danceStyles"`
+	Type             string     `json:"type"`
+	Levels           []string   `json:"levels"`
+	Capacity         int        `json:"capacity"`
+	MaxRoleImbalance int        `json:"maxRoleImbalance"`
+	Timezone         string     `json:"timezone,omitempty"`
+	RecurrenceID     *time.Time `json:"recurrenceId,omitempty"`
+	Cancelled        bool       `json:"cancelled"`
+	GroupKeywords    []string   `json:"groupKeywords,omitempty"`
+	// MinLevel and MaxLevel are left out for events without levels, so
+	// level range queries don't match them.
+	MinLevel int `json:"minLevel,omitempty"`
+	MaxLevel int `json:"maxLevel,omitempty"`
+	// Details only has the fields of the event's type.
+	Details *EventDetails `json:"details,omitempty"`
 }
 
 type GeoPoint struct {
@@ -34,15 +62,27 @@ type GeoPoint struct {
 	Longitude float64 `json:"lon"`
 }
 
+// NewEventSearchRepository returns a usable repository even when it also
+// returns an error creating the indices, e.g. because Elasticsearch is down.
+// The indices are then created on first use once it is reachable.
 func NewEventSearchRepository(es *elasticsearch.TypedClient, ctx context.Context) (*EventSearchRepository, error) {
-	esr := &EventSearchRepository{es}
+	esr := &EventSearchRepository{es: es}
 
-	err := createIndices(es, ctx)
+	return esr, esr.ensureIndices(ctx)
+}
+
+func (s *EventSearchRepository) ensureIndices(ctx context.Context) error {
+	if s.indicesReady.Load() {
+		return nil
+	}
+
+	err := createIndices(s.es, ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return esr, nil
+	s.indicesReady.Store(true)
+	return nil
 }
 
 func createIndices(es *elasticsearch.TypedClient, ctx context.Context) error {
@@ -56,27 +96,188 @@ func createIndices(es *elasticsearch.TypedClient, ctx context.Context) error {
 		return nil
 	}
 
-	mappings := &types.TypeMapping{
+	_, err = es.Indices.Create(versionedIndex()).
+		Mappings(eventMappings()).
+		Aliases(map[string]types.Alias{index: {}}).
+		Do(ctx)
+	return err
+}
+
+func versionedIndex() string {
+	return fmt.Sprintf("%s_%s", index, time.Now().UTC().Format("20060102150405"))
+}
+
+// eventMappings changes only reach existing deployments through a reindex.
+func eventMappings() *types.TypeMapping {
+	// The suggest subfields back type-ahead suggestions.
+	name := types.NewTextProperty()
+	name.Fields = map[string]types.Property{suggestField: types.NewCompletionProperty()}
+
+	location := types.NewTextProperty()
+	location.Fields = map[string]types.Property{
+		"keyword":    types.NewKeywordProperty(),
+		suggestField: types.NewCompletionProperty(),
+	}
+
+	danceStyles := types.NewKeywordProperty()
+	danceStyles.Fields = map[string]types.Property{suggestField: types.NewCompletionProperty()}
+
+	details := types.NewObjectProperty()
+	details.Properties = map[string]types.Property{
+		"endTime":       types.NewDateProperty(),
+		"teachers":      types.NewKeywordProperty(),
+		"prerequisites": types.NewKeywordProperty(),
+		"djs":           types.NewKeywordProperty(),
+		"artists":       types.NewKeywordProperty(),
+		"performers":    types.NewKeywordProperty(),
+	}
+
+	return &types.TypeMapping{
 		Properties: map[string]types.Property{
-			"id":          types.NewLongNumberProperty(),
-			"groupId":     types.NewLongNumberProperty(),
-			"name":        types.NewTextProperty(),
-			"time":        types.NewDateProperty(),
-			"location":    types.NewKeywordProperty(),
-			"locationGeo": types.NewGeoPointProperty(),
-			"danceStyles": types.NewKeywordProperty(),
-			"type":        types.NewKeywordProperty(),
-			"levels":      types.NewKeywordProperty(),
+			"id":               types.NewLongNumberProperty(),
+			"groupId":          types.NewLongNumberProperty(),
+			"name":             name,
+			"time":             types.NewDateProperty(),
+			"location":         location,
+			"locationGeo":      types.NewGeoPointProperty(),
+			"danceStyles":      danceStyles,
+			"type":             types.NewKeywordProperty(),
+			"levels":           types.NewKeywordProperty(),
+			"capacity":         types.NewIntegerNumberProperty(),
+			"maxRoleImbalance": types.NewIntegerNumberProperty(),
+			"timezone":         types.NewKeywordProperty(),
+			"recurrenceId":     types.NewDateProperty(),
+			"cancelled":        types.NewBooleanProperty(),
+			"groupKeywords":    types.NewTextProperty(),
+			"minLevel":         types.NewIntegerNumberProperty(),
+			"maxLevel":         types.NewIntegerNumberProperty(),
+			"details":          details,
 		},
 	}
+}
+
+// CreateVersionedIndex creates an empty index with the current mappings for a
+// reindex, without pointing the alias at it yet.
+func (s *EventSearchRepository) CreateVersionedIndex(ctx context.Context) (string, error) {
+	name := versionedIndex()
+
+	_, err := s.es.Indices.Create(name).Mappings(eventMappings()).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// BulkIndexEvents writes events straight into the named index.
+func (s *EventSearchRepository) BulkIndexEvents(indexName string, events []*models.Event, ctx context.Context) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	bulk := s.es.Bulk().Index(indexName)
+
+	for _, event := range events {
+		id := documentID(event.ID, event.RecurrenceID)
+
+		err := bulk.IndexOp(types.IndexOperation{Id_: &id}, newEventSearch(event))
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	if resp.Errors {
+		return fmt.Errorf("error indexing events into %s", indexName)
+	}
 
-	_, err = es.Indices.Create(index).Mappings(mappings).Do(ctx)
+	return nil
+}
+
+func (s *EventSearchRepository) DeleteIndex(indexName string, ctx context.Context) error {
+	_, err := s.es.Indices.Delete(indexName).Do(ctx)
 	return err
 }
 
-func (s *EventSearchRepository) IndexEvent(event *models.Event, ctx context.Context) error {
+// SwapAlias atomically points the alias at indexName and deletes the indices
+// it pointed at before. An index created before the alias existed, which has
+// the alias's name itself, is replaced in the same step.
+func (s *EventSearchRepository) SwapAlias(indexName string, ctx context.Context) error {
+	_, err := s.es.Indices.Refresh().Index(indexName).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	isAlias, err := s.es.Indices.ExistsAlias(index).IsSuccess(ctx)
+	if err != nil {
+		return err
+	}
+
+	alias := index
+	actions := []types.IndicesActionVariant{
+		&types.IndicesAction{Add: &types.AddAction{Index: &indexName, Alias: &alias}},
+	}
 
-	e := &EventSearch{
+	var old []string
+
+	if isAlias {
+		aliases, err := s.es.Indices.GetAlias().Name(index).Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		for name := range aliases {
+			if name == indexName {
+				continue
+			}
+
+			old = append(old, name)
+			actions = append(actions, &types.IndicesAction{Remove: &types.RemoveAction{Index: &name, Alias: &alias}})
+		}
+	} else {
+		exists, err := s.es.Indices.Exists(index).IsSuccess(ctx)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			actions = append(actions, &types.IndicesAction{RemoveIndex: &types.RemoveIndexAction{Index: &alias}})
+		}
+	}
+
+	_, err = s.es.Indices.UpdateAliases().Actions(actions...).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range old {
+		_, err = s.es.Indices.Delete(name).Do(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// documentID keys documents by the Postgres event ID, plus the original start
+// for occurrences of recurring events, so indexing an event again overwrites
+// its documents instead of adding new ones.
+func documentID(id int64, recurrenceID *time.Time) string {
+	if recurrenceID == nil {
+		return strconv.FormatInt(id, 10)
+	}
+
+	return fmt.Sprintf("%d_%d", id, recurrenceID.Unix())
+}
+
+func newEventSearch(event *models.Event) *EventSearch {
+	return &EventSearch{
+		ID:       event.ID,
 		Name:     event.Name,
 		GroupID:  event.GroupID,
 		Time:     event.Time,
@@ -85,12 +286,52 @@ func (s *EventSearchRepository) IndexEvent(event *models.Event, ctx context.Cont
 			Latitude:  event.Latitude,
 			Longitude: event.Longitude,
 		},
-		DanceStyles: event.DanceStyles,
-		Type:        event.Type,
-		Levels:      event.Levels,
+		DanceStyles:      event.DanceStyles,
+		Type:             event.Type,
+		Levels:           event.Levels,
+		Capacity:         event.Capacity,
+		MaxRoleImbalance: event.MaxRoleImbalance,
+		Timezone:         event.Timezone,
+		RecurrenceID:     event.RecurrenceID,
+		Cancelled:        event.Cancelled,
+		GroupKeywords:    event.GroupKeyWords,
+		MinLevel:         event.MinLevel,
+		MaxLevel:         event.MaxLevel,
+		Details:          newEventDetails(event.Details),
 	}
+}
+
+func (s *EventSearchRepository) IndexEvent(event *models.Event, ctx context.Context) error {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	e := newEventSearch(event)
+
+	_, err = s.es.Index(index).Id(documentID(event.ID, event.RecurrenceID)).Request(e).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
-	_, err := s.es.Index("events").Request(e).Do(ctx)
+// RemoveEvent removes every document of an event, including all indexed
+// occurrences of a recurring event.
+func (s *EventSearchRepository) RemoveEvent(id int64, ctx context.Context) error {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := &types.Query{
+		Term: map[string]types.TermQuery{
+			"id": {Value: id},
+		},
+	}
+
+	_, err = s.es.DeleteByQuery(index).Query(query).Do(ctx)
 	if err != nil {
 		return err
 	}
@@ -98,31 +339,459 @@ func (s *EventSearchRepository) IndexEvent(event *models.Event, ctx context.Cont
 	return nil
 }
 
-func (s *EventSearchRepository) GetEvents(lat, long, distance float64, ctx context.Context) ([]*models.Event, error) {
+// PruneEvent removes the documents of an event other than those of the given
+// current occurrences, e.g. occurrences dropped from a recurrence rule.
+func (s *EventSearchRepository) PruneEvent(id int64, current []*models.Event, ctx context.Context) error {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	keep := make([]string, 0, len(current))
+	for _, event := range current {
+		keep = append(keep, documentID(event.ID, event.RecurrenceID))
+	}
+
 	query := &types.Query{
 		Bool: &types.BoolQuery{
 			Filter: []types.Query{
 				{
-					GeoDistance: &types.GeoDistanceQuery{
-						Distance: fmt.Sprintf("%.2fkm", distance), // Distance in kilometers
-						GeoDistanceQuery: map[string]types.GeoLocation{
-							"locationGeo": types.LatLonGeoLocation{
-								Lat: types.Float64(lat),
-								Lon: types.Float64(long),
-							},
-						},
+					Term: map[string]types.TermQuery{
+						"id": {Value: id},
 					},
 				},
 			},
+			MustNot: []types.Query{
+				{
+					Ids: &types.IdsQuery{Values: keep},
+				},
+			},
 		},
 	}
 
-	resp, err := s.es.Search().Query(query).Do(ctx)
+	_, err = s.es.DeleteByQuery(index).Query(query).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deduplicate deletes every document whose ID isn't its documentID, which
+// covers the duplicates written before documents had stable IDs. The events
+// have to be indexed again afterwards so that each has its keyed document.
+func (s *EventSearchRepository) Deduplicate(ctx context.Context) (int, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.es.Search().
+		Index(index).
+		Scroll("1m").
+		Size(1000).
+		Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	hits, scrollID := resp.Hits.Hits, resp.ScrollId_
+	bulk := s.es.Bulk().Index(index)
+	removed := 0
+
+	for len(hits) > 0 {
+		for _, hit := range hits {
+			eventSearch := &EventSearch{}
+			err := json.Unmarshal(hit.Source_, eventSearch)
+			if err != nil {
+				return 0, err
+			}
+
+			if hit.Id_ == nil || *hit.Id_ == documentID(eventSearch.ID, eventSearch.RecurrenceID) {
+				continue
+			}
+
+			err = bulk.DeleteOp(types.DeleteOperation{Id_: hit.Id_})
+			if err != nil {
+				return 0, err
+			}
+			removed++
+		}
+
+		if scrollID == nil {
+			break
+		}
+
+		next, err := s.es.Scroll().Request(&scroll.Request{ScrollId: *scrollID, Scroll: "1m"}).Do(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		hits, scrollID = next.Hits.Hits, next.ScrollId_
+	}
+
+	if scrollID != nil {
+		_, err = s.es.ClearScroll().ScrollId(*scrollID).Do(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	bulkResp, err := bulk.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if bulkResp.Errors {
+		return 0, fmt.Errorf("error deleting duplicate documents")
+	}
+
+	return removed, nil
+}
+
+func (e *EventSearch) toModel() *models.Event {
+	return &models.Event{
+		ID:               e.ID,
+		Name:             e.Name,
+		GroupID:          e.GroupID,
+		Time:             e.Time,
+		Location:         e.Location,
+		Latitude:         e.LocationGeo.Latitude,
+		Longitude:        e.LocationGeo.Longitude,
+		DanceStyles:      e.DanceStyles,
+		Type:             e.Type,
+		Levels:           e.Levels,
+		Capacity:         e.Capacity,
+		MaxRoleImbalance: e.MaxRoleImbalance,
+		Timezone:         e.Timezone,
+		RecurrenceID:     e.RecurrenceID,
+		Cancelled:        e.Cancelled,
+		MinLevel:         e.MinLevel,
+		MaxLevel:         e.MaxLevel,
+		Details:          e.Details.toModel(),
+	}
+}
+
+// facetSize is the number of values returned per facet.
+const facetSize = 50
+
+// facetFields maps the index fields events are faceted on to the filter
+// values for them.
+func facetFields(filter *models.EventSearchFilter) map[string][]string {
+	return map[string][]string{
+		"danceStyles": filter.DanceStyles,
+		"levels":      filter.Levels,
+		"type":        filter.Types,
+	}
+}
+
+func termsQuery(field string, values []string) types.Query {
+	fieldValues := make([]types.FieldValue, 0, len(values))
+	for _, v := range values {
+		fieldValues = append(fieldValues, v)
+	}
+
+	return types.Query{
+		Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{field: fieldValues},
+		},
+	}
+}
+
+// textFields are searched by the text query, the name weighing the most.
+var textFields = []string{"name^3", "location", "groupKeywords"}
+
+// searchQuery builds the query shared by every facet: the text query, which
+// alone is scored, and the location, time and cancellation filters.
+func searchQuery(filter *models.EventSearchFilter) (*types.Query, error) {
+	query := &types.Query{Bool: &types.BoolQuery{}}
+
+	if filter.Query != "" {
+		query.Bool.Must = []types.Query{
+			{
+				MultiMatch: &types.MultiMatchQuery{
+					Query:     filter.Query,
+					Fields:    textFields,
+					Fuzziness: "AUTO",
+				},
+			},
+		}
+	}
+
+	if filter.Distance > 0 {
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			GeoDistance: &types.GeoDistanceQuery{
+				Distance: fmt.Sprintf("%.2fkm", filter.Distance), // Distance in kilometers
+				GeoDistanceQuery: map[string]types.GeoLocation{
+					"locationGeo": types.LatLonGeoLocation{
+						Lat: types.Float64(filter.Latitude),
+						Lon: types.Float64(filter.Longitude),
+					},
+				},
+			},
+		})
+	}
+
+	if filter.BoundingBox != nil {
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			GeoBoundingBox: &types.GeoBoundingBoxQuery{
+				GeoBoundingBoxQuery: map[string]types.GeoBounds{
+					"locationGeo": types.TopLeftBottomRightGeoBounds{
+						TopLeft: types.LatLonGeoLocation{
+							Lat: types.Float64(filter.BoundingBox.Top),
+							Lon: types.Float64(filter.BoundingBox.Left),
+						},
+						BottomRight: types.LatLonGeoLocation{
+							Lat: types.Float64(filter.BoundingBox.Bottom),
+							Lon: types.Float64(filter.BoundingBox.Right),
+						},
+					},
+				},
+			},
+		})
+	}
+
+	if len(filter.Area) > 0 {
+		shape, err := areaShape(filter.Area)
+		if err != nil {
+			return nil, err
+		}
+
+		// geo_shape queries work on geo_point fields too.
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			GeoShape: &types.GeoShapeQuery{
+				GeoShapeQuery: map[string]types.GeoShapeFieldQuery{
+					"locationGeo": {Shape: shape, Relation: &geoshaperelation.Intersects},
+				},
+			},
+		})
+	}
+
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timeRange := types.DateRangeQuery{}
+		if !filter.From.IsZero() {
+			from := filter.From.Format(time.RFC3339)
+			timeRange.Gte = &from
+		}
+		if !filter.To.IsZero() {
+			to := filter.To.Format(time.RFC3339)
+			timeRange.Lt = &to
+		}
+
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			Range: map[string]types.RangeQuery{"time": timeRange},
+		})
+	}
+
+	// An event is in a level range when its lowest level isn't above the
+	// range and its highest isn't below it.
+	if filter.MinLevel > 0 {
+		minLevel := types.Float64(filter.MinLevel)
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			Range: map[string]types.RangeQuery{"maxLevel": types.NumberRangeQuery{Gte: &minLevel}},
+		})
+	}
+
+	if filter.MaxLevel > 0 {
+		maxLevel := types.Float64(filter.MaxLevel)
+		query.Bool.Filter = append(query.Bool.Filter, types.Query{
+			Range: map[string]types.RangeQuery{"minLevel": types.NumberRangeQuery{Lte: &maxLevel}},
+		})
+	}
+
+	for _, field := range detailFields(filter.Details) {
+		query.Bool.Filter = append(query.Bool.Filter, termsQuery("details."+field, filter.Details[field]))
+	}
+
+	if !filter.IncludeCancelled {
+		query.Bool.MustNot = []types.Query{
+			{
+				Term: map[string]types.TermQuery{
+					"cancelled": {Value: true},
+				},
+			},
+		}
+	}
+
+	return query, nil
+}
+
+// areaShape encodes polygons as a GeoJSON MultiPolygon.
+func areaShape(area []models.Polygon) (json.RawMessage, error) {
+	coordinates := make([][][][2]float64, 0, len(area))
+	for _, polygon := range area {
+		rings := make([][][2]float64, 0, len(polygon))
+		for _, ring := range polygon {
+			positions := make([][2]float64, 0, len(ring))
+			for _, p := range ring {
+				positions = append(positions, [2]float64{p.Longitude, p.Latitude})
+			}
+			rings = append(rings, positions)
+		}
+		coordinates = append(coordinates, rings)
+	}
+
+	return json.Marshal(map[string]any{
+		"type":        "MultiPolygon",
+		"coordinates": coordinates,
+	})
+}
+
+// searchSort orders events by relevance for text queries, then by distance
+// when searching near a location, then by time. The event ID breaks ties so
+// pages never overlap.
+func searchSort(filter *models.EventSearchFilter) []types.SortCombinations {
+	var sorts []types.SortCombinations
+
+	// Collapsing keeps the first hit of each event, so distinct searches are
+	// sorted by time alone to keep the next occurrence.
+	if filter.Query != "" && !filter.Distinct {
+		sorts = append(sorts, types.SortOptions{Score_: &types.ScoreSort{Order: &sortorder.Desc}})
+	}
+
+	if filter.Distance > 0 && !filter.Distinct {
+		sorts = append(sorts, types.SortOptions{
+			GeoDistance_: &types.GeoDistanceSort{
+				GeoDistanceSort: map[string][]types.GeoLocation{
+					"locationGeo": {types.LatLonGeoLocation{
+						Lat: types.Float64(filter.Latitude),
+						Lon: types.Float64(filter.Longitude),
+					}},
+				},
+				Unit:  &distanceunit.Kilometers,
+				Order: &sortorder.Asc,
+			},
+		})
+	}
+
+	return append(sorts,
+		types.SortOptions{SortOptions: map[string]types.FieldSort{"time": {Order: &sortorder.Asc}}},
+		types.SortOptions{SortOptions: map[string]types.FieldSort{"id": {Order: &sortorder.Asc}}},
+	)
+}
+
+func searchAfter(after []any) []types.FieldValue {
+	values := make([]types.FieldValue, 0, len(after))
+	for _, v := range after {
+		values = append(values, v)
+	}
+	return values
+}
+
+// searchError reports searches Elasticsearch refused as invalid, like a
+// query it can't parse, as validation errors, so they aren't taken for an
+// unavailable backend. Timeouts and throttling are left as they are.
+func searchError(err error) error {
+	var esErr *types.ElasticsearchError
+	if !errors.As(err, &esErr) {
+		return err
+	}
+
+	switch {
+	case esErr.Status == http.StatusRequestTimeout, esErr.Status == http.StatusTooManyRequests:
+		return err
+	case esErr.Status >= 400 && esErr.Status < 500:
+		return models.Invalidf("invalid search: %v", esErr)
+	}
+
+	return err
+}
+
+// GetEvents applies the facet filters as a post filter, so each facet can be
+// aggregated with the filters of the other facets only.
+func (s *EventSearchRepository) GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := facetFields(filter)
+	facetFilters := make(map[string]types.Query)
+	for field, values := range fields {
+		if len(values) > 0 {
+			facetFilters[field] = termsQuery(field, values)
+		}
+	}
+
+	postFilter := &types.Query{Bool: &types.BoolQuery{}}
+	aggregations := make(map[string]types.Aggregations)
+
+	for field := range fields {
+		if q, ok := facetFilters[field]; ok {
+			postFilter.Bool.Filter = append(postFilter.Bool.Filter, q)
+		}
+
+		others := &types.Query{Bool: &types.BoolQuery{}}
+		for other, q := range facetFilters {
+			if other != field {
+				others.Bool.Filter = append(others.Bool.Filter, q)
+			}
+		}
+
+		termsField, size := field, facetSize
+		aggregations[field] = types.Aggregations{
+			Filter: others,
+			Aggregations: map[string]types.Aggregations{
+				"values": {Terms: &types.TermsAggregation{Field: &termsField, Size: &size}},
+			},
+		}
+	}
+
+	query, err := searchQuery(filter)
 	if err != nil {
 		return nil, err
 	}
 
-	var events []*models.Event
+	request := &searchapi.Request{
+		Sort:        searchSort(filter),
+		SearchAfter: searchAfter(filter.After),
+	}
+
+	// Occurrences are sorted by time, so collapsing keeps the first one.
+	if filter.Distinct {
+		request.Collapse = &types.FieldCollapse{Field: "id"}
+	}
+
+	search := s.es.Search().
+		Request(request).
+		Index(index).
+		Size(filter.Size).
+		Query(query).
+		PostFilter(postFilter).
+		Aggregations(aggregations)
+
+	if filter.Query != "" {
+		search = search.Highlight(&types.Highlight{
+			Fields: map[string]types.HighlightField{
+				"name":          {},
+				"location":      {},
+				"groupKeywords": {},
+			},
+		})
+	}
+
+	resp, err := search.Do(ctx)
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	result := &models.EventSearchResult{
+		Hits: make([]*models.EventSearchHit, 0, len(resp.Hits.Hits)),
+		Facets: &models.EventFacets{
+			DanceStyles: facetCounts(resp.Aggregations["danceStyles"]),
+			Levels:      facetCounts(resp.Aggregations["levels"]),
+			Types:       facetCounts(resp.Aggregations["type"]),
+		},
+	}
+
+	if resp.Hits.Total != nil {
+		result.Total = int(resp.Hits.Total.Value)
+	}
+
 	for _, hit := range resp.Hits.Hits {
 
 		eventSearch := &EventSearch{}
@@ -131,18 +800,421 @@ func (s *EventSearchRepository) GetEvents(lat, long, distance float64, ctx conte
 			return nil, err
 		}
 
-		event := &models.Event{
-			Name:        eventSearch.Name,
-			GroupID:     eventSearch.GroupID,
-			Time:        eventSearch.Time,
-			Location:    eventSearch.Location,
-			Latitude:    eventSearch.LocationGeo.Latitude,
-			Longitude:   eventSearch.LocationGeo.Longitude,
-			DanceStyles: eventSearch.DanceStyles,
-			Type:        eventSearch.Type,
-			Levels:      eventSearch.Levels,
+		sortValues := make([]any, 0, len(hit.Sort))
+		for _, v := range hit.Sort {
+			sortValues = append(sortValues, v)
+		}
+
+		result.Hits = append(result.Hits, &models.EventSearchHit{
+			Event:      eventSearch.toModel(),
+			Highlights: hit.Highlight,
+			Sort:       sortValues,
+		})
+	}
+
+	return result, nil
+}
+
+func facetCounts(aggregate types.Aggregate) []models.FacetCount {
+	filtered, ok := aggregate.(*types.FilterAggregate)
+	if !ok {
+		return nil
+	}
+
+	return termsCounts(filtered.Aggregations["values"])
+}
+
+func termsCounts(aggregate types.Aggregate) []models.FacetCount {
+	terms, ok := aggregate.(*types.StringTermsAggregate)
+	if !ok {
+		return nil
+	}
+
+	buckets, ok := terms.Buckets.([]types.StringTermsBucket)
+	if !ok {
+		return nil
+	}
+
+	counts := make([]models.FacetCount, 0, len(buckets))
+	for _, b := range buckets {
+		counts = append(counts, models.FacetCount{
+			Value: fmt.Sprint(b.Key),
+			Count: int(b.DocCount),
+		})
+	}
+
+	return counts
+}
+
+// GetEventClusters buckets the matching events into map tiles at the given
+// zoom precision, counting distinct events rather than occurrences.
+func (s *EventSearchRepository) GetEventClusters(filter *models.EventSearchFilter, precision int, ctx context.Context) ([]*models.EventCluster, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := aggregationQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	field, idField, size := "locationGeo", "id", maxClusters
+	aggregations := map[string]types.Aggregations{
+		"tiles": {
+			GeotileGrid: &types.GeoTileGridAggregation{Field: &field, Precision: &precision, Size: &size},
+			Aggregations: map[string]types.Aggregations{
+				"centroid": {GeoCentroid: &types.GeoCentroidAggregation{Field: &field}},
+				"events":   {Cardinality: &types.CardinalityAggregation{Field: &idField}},
+			},
+		},
+	}
+
+	resp, err := s.es.Search().
+		Index(index).
+		Size(0).
+		Query(query).
+		Aggregations(aggregations).
+		Do(ctx)
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	tiles, ok := resp.Aggregations["tiles"].(*types.GeoTileGridAggregate)
+	if !ok {
+		return nil, fmt.Errorf("unexpected tiles aggregation %T", resp.Aggregations["tiles"])
+	}
+
+	buckets, ok := tiles.Buckets.([]types.GeoTileGridBucket)
+	if !ok {
+		return nil, fmt.Errorf("unexpected tiles buckets %T", tiles.Buckets)
+	}
+
+	clusters := make([]*models.EventCluster, 0, len(buckets))
+	for _, b := range buckets {
+		cluster := &models.EventCluster{Key: b.Key, Count: int(b.DocCount)}
+
+		if events, ok := b.Aggregations["events"].(*types.CardinalityAggregate); ok {
+			cluster.Count = int(events.Value)
+		}
+
+		if centroid, ok := b.Aggregations["centroid"].(*types.GeoCentroidAggregate); ok {
+			if location, ok := centroid.Location.(*types.LatLonGeoLocation); ok {
+				cluster.Latitude = float64(location.Lat)
+				cluster.Longitude = float64(location.Lon)
+			}
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+// maxClusters caps the tiles returned for a viewport.
+const maxClusters = 10000
+
+// suggestField is the completion subfield of the fields suggestions come from.
+const suggestField = "suggest"
+
+// GetSuggestions completes prefix to event names, locations and dance styles,
+// tolerating typos.
+func (s *EventSearchRepository) GetSuggestions(prefix string, size int, ctx context.Context) (*models.EventSuggestions, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	skipDuplicates := true
+	completion := func(field string) types.FieldSuggester {
+		return types.FieldSuggester{
+			Prefix: &prefix,
+			Completion: &types.CompletionSuggester{
+				Field:          field + "." + suggestField,
+				Fuzzy:          &types.SuggestFuzziness{Fuzziness: "AUTO"},
+				Size:           &size,
+				SkipDuplicates: &skipDuplicates,
+			},
+		}
+	}
+
+	resp, err := s.es.Search().
+		Index(index).
+		Size(0).
+		Suggest(&types.Suggester{
+			Suggesters: map[string]types.FieldSuggester{
+				"name":        completion("name"),
+				"location":    completion("location"),
+				"danceStyles": completion("danceStyles"),
+			},
+		}).
+		Do(ctx)
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	options := func(name string) []string {
+		texts := []string{}
+		for _, suggest := range resp.Suggest[name] {
+			if completion, ok := suggest.(*types.CompletionSuggest); ok {
+				for _, option := range completion.Options {
+					texts = append(texts, option.Text)
+				}
+			}
+		}
+		return texts
+	}
+
+	return &models.EventSuggestions{
+		Names:       options("name"),
+		Locations:   options("location"),
+		DanceStyles: options("danceStyles"),
+	}, nil
+}
+
+// aggregationQuery is the search query with the facet filters applied
+// directly, for aggregations without hits that need no post filter.
+func aggregationQuery(filter *models.EventSearchFilter) (*types.Query, error) {
+	query, err := searchQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, values := range facetFields(filter) {
+		if len(values) > 0 {
+			query.Bool.Filter = append(query.Bool.Filter, termsQuery(field, values))
+		}
+	}
+
+	return query, nil
+}
+
+// localTimeScript evaluates to the start of an occurrence in the event's own
+// time zone, so weekdays and hours are the ones on the flyer.
+const localTimeScript = `ZonedDateTime t = doc['time'].value;
+if (doc['timezone'].size() > 0) {
+	t = t.withZoneSameInstant(ZoneId.of(doc['timezone'].value));
+}
+`
+
+// GetEventStats counts the matching occurrences per dance style, level, type,
+// local weekday and hour, and per interval, one of day, week or month.
+func (s *EventSearchRepository) GetEventStats(filter *models.EventSearchFilter, interval string, ctx context.Context) (*models.EventStats, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := aggregationQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := func(field string) types.Aggregations {
+		size := facetSize
+		return types.Aggregations{Terms: &types.TermsAggregation{Field: &field, Size: &size}}
+	}
+
+	// Script terms are strings unless typed, and the buckets are read as
+	// longs.
+	script := func(source string, size int) types.Aggregations {
+		source = localTimeScript + source
+		valueType := "long"
+		return types.Aggregations{Terms: &types.TermsAggregation{Script: &types.Script{Source: &source}, ValueType: &valueType, Size: &size}}
+	}
+
+	timeField := "time"
+	calendarInterval := calendarinterval.CalendarInterval{Name: interval}
+
+	// Totals are exact, not capped at the default 10000.
+	resp, err := s.es.Search().
+		Request(&searchapi.Request{TrackTotalHits: true}).
+		Index(index).
+		Size(0).
+		Query(query).
+		Aggregations(map[string]types.Aggregations{
+			"danceStyles": terms("danceStyles"),
+			"levels":      terms("levels"),
+			"type":        terms("type"),
+			"weekdays":    script("return t.getDayOfWeekEnum().getValue();", 7),
+			"hours":       script("return t.getHour();", 24),
+			"histogram": {
+				DateHistogram: &types.DateHistogramAggregation{Field: &timeField, CalendarInterval: &calendarInterval},
+			},
+		}).
+		Do(ctx)
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	stats := &models.EventStats{
+		DanceStyles: termsCounts(resp.Aggregations["danceStyles"]),
+		Levels:      termsCounts(resp.Aggregations["levels"]),
+		Types:       termsCounts(resp.Aggregations["type"]),
+	}
+
+	if resp.Hits.Total != nil {
+		stats.Total = int(resp.Hits.Total.Value)
+	}
+
+	for _, b := range longTermsBuckets(resp.Aggregations["weekdays"]) {
+		// ISO weekdays run from 1 for Monday to 7 for Sunday.
+		stats.Weekdays[time.Weekday(b.Key%7)] = int(b.DocCount)
+	}
+
+	for _, b := range longTermsBuckets(resp.Aggregations["hours"]) {
+		if b.Key >= 0 && b.Key < 24 {
+			stats.Hours[b.Key] = int(b.DocCount)
+		}
+	}
+
+	if histogram, ok := resp.Aggregations["histogram"].(*types.DateHistogramAggregate); ok {
+		if buckets, ok := histogram.Buckets.([]types.DateHistogramBucket); ok {
+			for _, b := range buckets {
+				stats.Histogram = append(stats.Histogram, models.DateCount{
+					Start: time.UnixMilli(b.Key).UTC(),
+					Count: int(b.DocCount),
+				})
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func longTermsBuckets(aggregate types.Aggregate) []types.LongTermsBucket {
+	terms, ok := aggregate.(*types.LongTermsAggregate)
+	if !ok {
+		return nil
+	}
+
+	buckets, _ := terms.Buckets.([]types.LongTermsBucket)
+	return buckets
+}
+
+// Similar events score lower the further they are from the event, halving at
+// these distances past the offsets.
+const (
+	similarGeoScale   = "25km"
+	similarGeoOffset  = "2km"
+	similarTimeScale  = "14d"
+	similarTimeOffset = "1d"
+)
+
+// GetSimilarEvents finds upcoming events like event: sharing words with its
+// name and group keywords, its dance styles, levels or type, and close to it
+// in place and time. Each event is returned once, at its next occurrence.
+func (s *EventSearchRepository) GetSimilarEvents(event *models.Event, size int, ctx context.Context) ([]*models.Event, error) {
+	err := s.ensureIndices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	one := 1
+	like := strings.Join(append([]string{event.Name}, event.GroupKeyWords...), " ")
+
+	should := []types.Query{
+		{
+			MoreLikeThis: &types.MoreLikeThisQuery{
+				Fields: []string{"name", "groupKeywords"},
+				Like:   []types.Like{like},
+				// A single event is little text to go on.
+				MinTermFreq: &one,
+				MinDocFreq:  &one,
+			},
+		},
+	}
+
+	overlaps := []struct {
+		field  string
+		values []string
+		boost  float32
+	}{
+		{"danceStyles", event.DanceStyles, 2},
+		{"levels", event.Levels, 1},
+		{"type", []string{event.Type}, 1},
+	}
+
+	for _, o := range overlaps {
+		if len(o.values) == 0 || o.values[0] == "" {
+			continue
+		}
+
+		q := termsQuery(o.field, o.values)
+		boost := o.boost
+		q.Terms.Boost = &boost
+		should = append(should, q)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	origin := event.Time.Format(time.RFC3339)
+	geoScale, geoOffset := similarGeoScale, similarGeoOffset
+
+	query := &types.Query{
+		FunctionScore: &types.FunctionScoreQuery{
+			Query: &types.Query{
+				Bool: &types.BoolQuery{
+					Should:             should,
+					MinimumShouldMatch: 1,
+					Filter: []types.Query{
+						{Range: map[string]types.RangeQuery{"time": types.DateRangeQuery{Gte: &now}}},
+					},
+					MustNot: []types.Query{
+						{Term: map[string]types.TermQuery{"id": {Value: event.ID}}},
+						{Term: map[string]types.TermQuery{"cancelled": {Value: true}}},
+					},
+				},
+			},
+			Functions: []types.FunctionScore{
+				{
+					Gauss: types.GeoDecayFunction{
+						DecayFunctionBaseGeoLocationDistance: map[string]types.DecayPlacementGeoLocationDistance{
+							"locationGeo": {
+								Origin: types.LatLonGeoLocation{
+									Lat: types.Float64(event.Latitude),
+									Lon: types.Float64(event.Longitude),
+								},
+								Scale:  &geoScale,
+								Offset: &geoOffset,
+							},
+						},
+					},
+				},
+				{
+					Gauss: types.DateDecayFunction{
+						DecayFunctionBaseDateMathDuration: map[string]types.DecayPlacementDateMathDuration{
+							"time": {
+								Origin: &origin,
+								Scale:  similarTimeScale,
+								Offset: similarTimeOffset,
+							},
+						},
+					},
+				},
+			},
+			ScoreMode: &functionscoremode.Multiply,
+			BoostMode: &functionboostmode.Multiply,
+		},
+	}
+
+	resp, err := s.es.Search().
+		Request(&searchapi.Request{Collapse: &types.FieldCollapse{Field: "id"}}).
+		Index(index).
+		Size(size).
+		Query(query).
+		Do(ctx)
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	events := make([]*models.Event, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		eventSearch := &EventSearch{}
+		err := json.Unmarshal(hit.Source_, eventSearch)
+		if err != nil {
+			return nil, err
 		}
-		events = append(events, event)
+		events = append(events, eventSearch.toModel())
 	}
 
 	return events, nil
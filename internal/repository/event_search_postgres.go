@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+
+	"github.com/uptrace/bun"
+)
+
+// EventPostgresSearchRepository answers event searches straight from the
+// events table with the earthdistance extension, for deployments without
+// Elasticsearch. The events table is the index, so indexing is a no-op.
+type EventPostgresSearchRepository struct {
+	db *bun.DB
+}
+
+func NewEventPostgresSearchRepository(db *bun.DB, ctx context.Context) (*EventPostgresSearchRepository, error) {
+	epsr := &EventPostgresSearchRepository{db}
+
+	err := epsr.createSearchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return epsr, nil
+}
+
+func (s *EventPostgresSearchRepository) createSearchIndex(ctx context.Context) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS cube",
+		"CREATE EXTENSION IF NOT EXISTS earthdistance",
+		"CREATE INDEX IF NOT EXISTS events_location_earth_idx ON events USING gist (ll_to_earth(latitude, longitude))",
+	}
+
+	for _, statement := range statements {
+		_, err := s.db.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetEvents returns the events within distance kilometres. Recurring events
+// are returned as series, not as occurrences, so time and facet filtering is
+// left to the caller.
+func (s *EventPostgresSearchRepository) GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	var events []Event
+
+	lat, long := filter.Latitude, filter.Longitude
+	meters := filter.Distance * 1000
+
+	query := textFilter(s.db.NewSelect().Model(&events), filter.Query)
+	query = boundingBoxFilter(query, filter.BoundingBox)
+	query = areaFilter(query, filter.Area)
+	query = levelFilter(query, filter.MinLevel, filter.MaxLevel)
+	query = detailsFilter(query, filter.Details)
+
+	if meters > 0 {
+		// earth_box is a bounding cube that can use the GiST index, the
+		// distance check then drops the corners.
+		query = query.
+			Where("earth_box(ll_to_earth(?, ?), ?) @> ll_to_earth(latitude, longitude)", lat, long, meters).
+			Where("earth_distance(ll_to_earth(?, ?), ll_to_earth(latitude, longitude)) <= ?", lat, long, meters)
+	}
+
+	if !filter.IncludeCancelled {
+		query = query.Where("NOT cancelled")
+	}
+
+	err := query.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.EventSearchResult{Hits: make([]*models.EventSearchHit, 0, len(events))}
+
+	for _, e := range events {
+		result.Hits = append(result.Hits, &models.EventSearchHit{Event: e.toModel()})
+	}
+
+	return result, nil
+}
+
+func (s *EventPostgresSearchRepository) GetSuggestions(prefix string, size int, ctx context.Context) (*models.EventSuggestions, error) {
+	return suggestions(s.db, prefix, size, ctx)
+}
+
+// GetSimilarEvents leaves scoring to the caller, like facets.
+func (s *EventPostgresSearchRepository) GetSimilarEvents(event *models.Event, size int, ctx context.Context) ([]*models.Event, error) {
+	return nil, models.ErrUnsupported
+}
+
+// GetEventStats leaves counting to the caller, like facets.
+func (s *EventPostgresSearchRepository) GetEventStats(filter *models.EventSearchFilter, interval string, ctx context.Context) (*models.EventStats, error) {
+	return nil, models.ErrUnsupported
+}
+
+// GetEventClusters leaves clustering to the caller, like facets.
+func (s *EventPostgresSearchRepository) GetEventClusters(filter *models.EventSearchFilter, precision int, ctx context.Context) ([]*models.EventCluster, error) {
+	return nil, models.ErrUnsupported
+}
+
+func (s *EventPostgresSearchRepository) IndexEvent(event *models.Event, ctx context.Context) error {
+	return nil
+}
+
+func (s *EventPostgresSearchRepository) RemoveEvent(id int64, ctx context.Context) error {
+	return nil
+}
+
+func (s *EventPostgresSearchRepository) PruneEvent(id int64, current []*models.Event, ctx context.Context) error {
+	return nil
+}
+
+func (s *EventPostgresSearchRepository) Deduplicate(ctx context.Context) (int, error) {
+	return 0, nil
+}
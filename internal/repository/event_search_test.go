@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/eventApp/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestSearchError(t *testing.T) {
+	esError := func(status int) error {
+		reason := "test"
+		return fmt.Errorf("searching: %w", &types.ElasticsearchError{Status: status, ErrorCause: types.ErrorCause{Reason: &reason}})
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		invalid bool
+	}{
+		{"bad request", esError(400), true},
+		{"missing index", esError(404), true},
+		{"timeout", esError(408), false},
+		{"throttled", esError(429), false},
+		{"server error", esError(500), false},
+		{"unavailable", esError(503), false},
+		{"transport", errors.New("connection refused"), false},
+		{"deadline", context.DeadlineExceeded, false},
+	}
+
+	for _, tt := range tests {
+		err := searchError(tt.err)
+
+		var invalid *models.ValidationError
+		if errors.As(err, &invalid) != tt.invalid {
+			t.Errorf("%s: got %v, want invalid %v", tt.name, err, tt.invalid)
+		}
+
+		if !tt.invalid && err != tt.err {
+			t.Errorf("%s: got %v, want the error unchanged", tt.name, err)
+		}
+	}
+}
+
+func TestSearchSortOfDistinctSearches(t *testing.T) {
+	filter := &models.EventSearchFilter{Query: "lindy", Latitude: 52.52, Longitude: 13.4, Distance: 10}
+
+	first := func(filter *models.EventSearchFilter) string {
+		b, err := json.Marshal(searchSort(filter)[0])
+		if err != nil {
+			t.Fatalf("marshalling sort: %v", err)
+		}
+		return string(b)
+	}
+
+	if got := first(filter); !strings.Contains(got, "_score") {
+		t.Errorf("text search sorted by %s first, want relevance", got)
+	}
+
+	filter.Distinct = true
+	if got := first(filter); !strings.Contains(got, `"time"`) {
+		t.Errorf("distinct search sorted by %s first, want time so collapsing keeps the next occurrence", got)
+	}
+}
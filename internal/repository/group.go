@@ -79,7 +79,15 @@ func (s *GroupRepository) UpdateGroup(id int64, group *models.Group, ctx context
 
 	updatedGroup := &Group{}
 
-	err := s.db.NewUpdate().Model(g).Where("id = ?", id).Returning("*").Scan(ctx, updatedGroup)
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().Model(g).Where("id = ?", id).Returning("*").Scan(ctx, updatedGroup)
+		if err != nil {
+			return err
+		}
+
+		// The group's keywords are indexed with each of its events.
+		return enqueueGroupSearchSync(tx, id, ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
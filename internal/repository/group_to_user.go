@@ -59,6 +59,10 @@ func (gtur *GroupToUserRepository) AddUserToGroup(gtu *models.GroupToUser, ctx c
 	return gum, nil
 }
 
+func (gtur *GroupToUserRepository) IsGroupMember(groupID, userID int64, ctx context.Context) (bool, error) {
+	return gtur.db.NewSelect().Model((*GroupToUser)(nil)).Where("group_id = ?", groupID).Where("user_id = ?", userID).Exists(ctx)
+}
+
 func (gtur *GroupToUserRepository) RemoveUserFromGroup(gtu *models.GroupToUser, ctx context.Context) error {
 	_, err := gtur.db.NewDelete().Model(&GroupToUser{}).Where("group_id = ?", gtu.GroupID).Where("user_id = ?", gtu.UserID).Exec(ctx)
 	if err != nil {
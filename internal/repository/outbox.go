@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type OutboxRepository struct {
+	db *bun.DB
+}
+
+type OutboxEntry struct {
+	bun.BaseModel `bun:"table:search_outbox,alias:so"`
+
+	ID            int64     `bun:",pk,autoincrement,nullzero"`
+	EventID       int64     `bun:",notnull"`
+	Attempts      int       `bun:",notnull,default:0"`
+	LastError     string    `bun:",notnull,default:''"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	NextAttemptAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	DeadAt        time.Time `bun:",nullzero"`
+	ProcessedAt   time.Time `bun:",nullzero"`
+}
+
+func NewOutboxRepository(db *bun.DB, ctx context.Context) (*OutboxRepository, error) {
+	or := &OutboxRepository{db}
+	err := or.createOutboxTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return or, nil
+}
+
+func (s *OutboxRepository) createOutboxTable(ctx context.Context) error {
+	_, err := s.db.NewCreateTable().IfNotExists().Model((*OutboxEntry)(nil)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE search_outbox ADD COLUMN IF NOT EXISTS processed_at timestamptz")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (oe *OutboxEntry) toModel() *models.OutboxEntry {
+	return &models.OutboxEntry{
+		ID:            oe.ID,
+		EventID:       oe.EventID,
+		Attempts:      oe.Attempts,
+		LastError:     oe.LastError,
+		CreatedAt:     oe.CreatedAt,
+		NextAttemptAt: oe.NextAttemptAt,
+		DeadAt:        oe.DeadAt,
+		ProcessedAt:   oe.ProcessedAt,
+	}
+}
+
+// enqueueSearchSync records a change to an event. It's called with the
+// transaction that writes the event, so the change and the outbox entry are
+// committed or rolled back together.
+func enqueueSearchSync(db bun.IDB, eventID int64, ctx context.Context) error {
+	_, err := db.NewInsert().Model(&OutboxEntry{EventID: eventID}).Exec(ctx)
+	return err
+}
+
+// enqueueGroupSearchSync records a change to every event of a group.
+func enqueueGroupSearchSync(db bun.IDB, groupID int64, ctx context.Context) error {
+	_, err := db.NewRaw("INSERT INTO search_outbox (event_id) SELECT id FROM events WHERE group_id = ?", groupID).Exec(ctx)
+	return err
+}
+
+// EnqueueRecurring records a change to every recurring event, so they are
+// expanded again.
+func (s *OutboxRepository) EnqueueRecurring(ctx context.Context) (int, error) {
+	res, err := s.db.NewRaw("INSERT INTO search_outbox (event_id) SELECT id FROM events WHERE recurrence IS NOT NULL").Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	enqueued, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(enqueued), nil
+}
+
+// ClaimPending returns up to limit entries that are due and pushes their next
+// attempt back by lease, so other workers skip them while they are processed
+// and they are retried if the worker dies before finishing them.
+func (s *OutboxRepository) ClaimPending(limit int, lease time.Duration, ctx context.Context) ([]*models.OutboxEntry, error) {
+	var entries []OutboxEntry
+
+	due := s.db.NewSelect().
+		Model((*OutboxEntry)(nil)).
+		Column("id").
+		Where("dead_at IS NULL").
+		Where("processed_at IS NULL").
+		Where("next_attempt_at <= now()").
+		Order("id ASC").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+
+	err := s.db.NewUpdate().
+		Model((*OutboxEntry)(nil)).
+		Set("next_attempt_at = ?", time.Now().Add(lease)).
+		Where("id IN (?)", due).
+		Returning("*").
+		Scan(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	mes := make([]*models.OutboxEntry, 0, len(entries))
+
+	for _, oe := range entries {
+		mes = append(mes, oe.toModel())
+	}
+
+	return mes, nil
+}
+
+// CompleteEntry marks an entry as processed. Processed entries are kept until
+// they are purged, so a reindex can replay the changes made while it ran.
+func (s *OutboxRepository) CompleteEntry(id int64, ctx context.Context) error {
+	_, err := s.db.NewUpdate().Model((*OutboxEntry)(nil)).Set("processed_at = now()").Where("id = ?", id).Exec(ctx)
+	return err
+}
+
+func (s *OutboxRepository) PurgeProcessed(before time.Time, ctx context.Context) error {
+	_, err := s.db.NewDelete().Model((*OutboxEntry)(nil)).Where("processed_at < ?", before).Exec(ctx)
+	return err
+}
+
+// RequeueSince puts every entry created since the given time back in the
+// queue, whether it was processed, pending or dead.
+func (s *OutboxRepository) RequeueSince(since time.Time, ctx context.Context) (int, error) {
+	res, err := s.db.NewUpdate().
+		Model((*OutboxEntry)(nil)).
+		Set("processed_at = NULL").
+		Set("dead_at = NULL").
+		Set("attempts = 0").
+		Set("next_attempt_at = now()").
+		Where("created_at >= ?", since).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(requeued), nil
+}
+
+// FailEntry records a failed attempt and schedules the next one, or moves the
+// entry to the dead letters when dead is set.
+func (s *OutboxRepository) FailEntry(id int64, lastError string, nextAttemptAt time.Time, dead bool, ctx context.Context) error {
+	query := s.db.NewUpdate().
+		Model((*OutboxEntry)(nil)).
+		Set("attempts = attempts + 1").
+		Set("last_error = ?", lastError).
+		Set("next_attempt_at = ?", nextAttemptAt).
+		Where("id = ?", id)
+
+	if dead {
+		query = query.Set("dead_at = now()")
+	}
+
+	_, err := query.Exec(ctx)
+	return err
+}
+
+func (s *OutboxRepository) GetStats(ctx context.Context) (*models.OutboxStats, error) {
+	var stats struct {
+		Pending         int
+		Retrying        int
+		Dead            int
+		OldestPendingAt *time.Time
+	}
+
+	err := s.db.NewSelect().
+		Model((*OutboxEntry)(nil)).
+		ColumnExpr("count(*) FILTER (WHERE dead_at IS NULL AND processed_at IS NULL) AS pending").
+		ColumnExpr("count(*) FILTER (WHERE dead_at IS NULL AND processed_at IS NULL AND attempts > 0) AS retrying").
+		ColumnExpr("count(*) FILTER (WHERE dead_at IS NOT NULL) AS dead").
+		ColumnExpr("min(created_at) FILTER (WHERE dead_at IS NULL AND processed_at IS NULL) AS oldest_pending_at").
+		Scan(ctx, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &models.OutboxStats{
+		Pending:  stats.Pending,
+		Retrying: stats.Retrying,
+		Dead:     stats.Dead,
+	}
+
+	if stats.OldestPendingAt != nil {
+		ms.OldestPendingAt = *stats.OldestPendingAt
+	}
+
+	return ms, nil
+}
+
+func (s *OutboxRepository) GetDeadEntries(limit int, ctx context.Context) ([]*models.OutboxEntry, error) {
+	var entries []OutboxEntry
+
+	err := s.db.NewSelect().Model(&entries).Where("dead_at IS NOT NULL").Order("dead_at DESC").Limit(limit).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mes := make([]*models.OutboxEntry, 0, len(entries))
+
+	for _, oe := range entries {
+		mes = append(mes, oe.toModel())
+	}
+
+	return mes, nil
+}
+
+// RetryDead puts all dead letters back in the queue with a fresh attempt count.
+func (s *OutboxRepository) RetryDead(ctx context.Context) (int, error) {
+	res, err := s.db.NewUpdate().
+		Model((*OutboxEntry)(nil)).
+		Set("dead_at = NULL").
+		Set("attempts = 0").
+		Set("next_attempt_at = now()").
+		Where("dead_at IS NOT NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	retried, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(retried), nil
+}
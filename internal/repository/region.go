@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github/eventApp/internal/models"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RegionRepository holds named search areas, loaded once from a GeoJSON
+// FeatureCollection whose features have a name property and a Polygon or
+// MultiPolygon geometry.
+type RegionRepository struct {
+	regions map[string]*models.Region
+}
+
+// geoJSONFeatureCollection is the part of RFC 7946 regions are read from.
+type geoJSONFeatureCollection struct {
+	Features []struct {
+		Properties struct {
+			Name string `json:"name"`
+		} `json:"properties"`
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// NewRegionRepository loads the regions in path, no path means no regions.
+func NewRegionRepository(path string) (*RegionRepository, error) {
+	rr := &RegionRepository{regions: make(map[string]*models.Region)}
+	if path == "" {
+		return rr, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc geoJSONFeatureCollection
+	err = json.Unmarshal(data, &fc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing regions: %w", err)
+	}
+
+	for i, f := range fc.Features {
+		if f.Properties.Name == "" {
+			return nil, fmt.Errorf("region %d has no name", i)
+		}
+
+		// Positions are longitude first, GeoJSON polygons nest rings in
+		// polygons in multipolygons.
+		var multiPolygon [][][][]float64
+		switch f.Geometry.Type {
+		case "Polygon":
+			var polygon [][][]float64
+			err = json.Unmarshal(f.Geometry.Coordinates, &polygon)
+			multiPolygon = [][][][]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(f.Geometry.Coordinates, &multiPolygon)
+		default:
+			err = fmt.Errorf("unsupported geometry %q", f.Geometry.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("region %q: %w", f.Properties.Name, err)
+		}
+
+		region := &models.Region{Name: f.Properties.Name}
+		for _, rings := range multiPolygon {
+			polygon := make(models.Polygon, 0, len(rings))
+			for _, ring := range rings {
+				if len(ring) < 4 {
+					return nil, fmt.Errorf("region %q has a ring with less than 4 positions", f.Properties.Name)
+				}
+
+				points := make([]models.GeoPoint, 0, len(ring))
+				for _, position := range ring {
+					if len(position) < 2 {
+						return nil, fmt.Errorf("region %q has an invalid position", f.Properties.Name)
+					}
+					points = append(points, models.GeoPoint{Latitude: position[1], Longitude: position[0]})
+				}
+				polygon = append(polygon, points)
+			}
+			region.Polygons = append(region.Polygons, polygon)
+		}
+
+		rr.regions[strings.ToLower(region.Name)] = region
+	}
+
+	return rr, nil
+}
+
+// GetRegion looks a region up by name, ignoring case.
+func (s *RegionRepository) GetRegion(name string, ctx context.Context) (*models.Region, error) {
+	region, ok := s.regions[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("region %q: %w", name, models.ErrNotFound)
+	}
+
+	return region, nil
+}
+
+func (s *RegionRepository) GetRegions(ctx context.Context) ([]*models.Region, error) {
+	regions := make([]*models.Region, 0, len(s.regions))
+	for _, region := range s.regions {
+		regions = append(regions, region)
+	}
+
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Name < regions[j].Name
+	})
+
+	return regions, nil
+}
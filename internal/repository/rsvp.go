@@ -0,0 +1,465 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github/eventApp/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type RSVPRepository struct {
+	db *bun.DB
+}
+
+type RSVP struct {
+	bun.BaseModel `bun:"table:rsvps,alias:r"`
+
+	EventID int64 `bun:",pk"`
+	// RecurrenceID is the zero time for one-off events, which have a
+	// single occurrence, as key columns can't be null.
+	RecurrenceID time.Time `bun:",pk"`
+	UserID       int64     `bun:",pk"`
+	Status       string    `bun:",notnull"`
+	Role         string    `bun:",notnull,default:''"`
+	UpdatedAt    time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+func (r *RSVP) toModel() *models.RSVP {
+	return &models.RSVP{
+		EventID:      r.EventID,
+		RecurrenceID: recurrenceIDFromKey(r.RecurrenceID),
+		UserID:       r.UserID,
+		Status:       r.Status,
+		Role:         r.Role,
+		UpdatedAt:    r.UpdatedAt,
+	}
+}
+
+// recurrenceKey is the stored form of an occurrence's recurrence ID.
+func recurrenceKey(recurrenceID *time.Time) time.Time {
+	if recurrenceID == nil {
+		return time.Time{}
+	}
+	return recurrenceID.UTC()
+}
+
+func recurrenceIDFromKey(key time.Time) *time.Time {
+	if key.IsZero() {
+		return nil
+	}
+	key = key.UTC()
+	return &key
+}
+
+func NewRSVPRepository(db *bun.DB, ctx context.Context) (*RSVPRepository, error) {
+	rr := &RSVPRepository{db}
+	err := rr.createRSVPTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+func (s *RSVPRepository) createRSVPTable(ctx context.Context) error {
+	_, err := s.db.NewCreateTable().IfNotExists().Model((*RSVP)(nil)).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE rsvps ADD COLUMN IF NOT EXISTS role varchar NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	// RSVPs from before they were kept per occurrence are all for one-off
+	// events, which have the zero time.
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE rsvps ADD COLUMN IF NOT EXISTS recurrence_id timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00+00'")
+	if err != nil {
+		return err
+	}
+
+	var keyed bool
+	err = s.db.NewRaw("SELECT EXISTS (SELECT 1 FROM information_schema.key_column_usage WHERE table_name = 'rsvps' AND constraint_name = 'rsvps_pkey' AND column_name = 'recurrence_id')").Scan(ctx, &keyed)
+	if err != nil {
+		return err
+	}
+
+	if !keyed {
+		_, err = s.db.ExecContext(ctx, "ALTER TABLE rsvps DROP CONSTRAINT IF EXISTS rsvps_pkey, ADD PRIMARY KEY (event_id, recurrence_id, user_id)")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetRSVP stores the user's answer for an occurrence of an event. Everything
+// runs in one transaction holding a lock on the event row, so capacity and
+// role balance checks and waitlist promotions for the same event never
+// interleave.
+func (s *RSVPRepository) SetRSVP(rsvp *models.RSVP, ctx context.Context) (*models.RSVP, error) {
+
+	savedRSVP := &RSVP{}
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		limits, err := lockEventLimits(tx, rsvp.EventID, ctx)
+		if err != nil {
+			return err
+		}
+
+		if rsvp.Status == models.RSVPGoing && limits.MaxRoleImbalance.Int64 > 0 && rsvp.Role == "" {
+			return models.Invalidf("event %d balances dance roles, a role is required", rsvp.EventID)
+		}
+
+		recurrenceID := recurrenceKey(rsvp.RecurrenceID)
+
+		existing := &RSVP{}
+		err = tx.NewSelect().
+			Model(existing).
+			Where("event_id = ?", rsvp.EventID).
+			Where("recurrence_id = ?", recurrenceID).
+			Where("user_id = ?", rsvp.UserID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		found := err == nil
+
+		// Asking to go again with the same role must not lose a seat or a
+		// place in the queue.
+		if found && rsvp.Status == models.RSVPGoing && rsvp.Role == existing.Role &&
+			(existing.Status == models.RSVPGoing || existing.Status == models.RSVPWaitlisted) {
+			*savedRSVP = *existing
+			return nil
+		}
+
+		status := rsvp.Status
+		if status == models.RSVPGoing {
+			counts, err := countGoingByRole(tx, rsvp.EventID, recurrenceID, rsvp.UserID, ctx)
+			if err != nil {
+				return err
+			}
+
+			if !counts.admits(rsvp.Role, limits) {
+				status = models.RSVPWaitlisted
+			}
+		}
+
+		r := &RSVP{
+			EventID:      rsvp.EventID,
+			RecurrenceID: recurrenceID,
+			UserID:       rsvp.UserID,
+			Status:       status,
+			Role:         rsvp.Role,
+			UpdatedAt:    time.Now(),
+		}
+
+		err = tx.NewInsert().
+			Model(r).
+			On("CONFLICT (event_id, recurrence_id, user_id) DO UPDATE").
+			Set("status = EXCLUDED.status").
+			Set("role = EXCLUDED.role").
+			Set("updated_at = EXCLUDED.updated_at").
+			Returning("*").
+			Scan(ctx, savedRSVP)
+		if err != nil {
+			return err
+		}
+
+		// Leaving frees a seat, and a new lead or follow can unblock someone
+		// of the opposite role, so the queue is re-checked on every change.
+		return promoteWaitlist(tx, rsvp.EventID, recurrenceID, limits, ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return savedRSVP.toModel(), nil
+}
+
+func (s *RSVPRepository) RemoveRSVP(eventID int64, recurrenceID *time.Time, userID int64, ctx context.Context) error {
+	return s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		limits, err := lockEventLimits(tx, eventID, ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*RSVP)(nil)).
+			Where("event_id = ?", eventID).
+			Where("recurrence_id = ?", recurrenceKey(recurrenceID)).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		return promoteWaitlist(tx, eventID, recurrenceKey(recurrenceID), limits, ctx)
+	})
+}
+
+type eventLimits struct {
+	Capacity         sql.NullInt64
+	MaxRoleImbalance sql.NullInt64
+}
+
+type roleCounts struct {
+	total  int
+	lead   int
+	follow int
+	both   int
+}
+
+// add counts an attendee. RSVPs from before roles existed have none and
+// only take a seat, they neither tip nor even out the balance.
+func (rc *roleCounts) add(role string) {
+	rc.total++
+	switch role {
+	case models.RoleLead:
+		rc.lead++
+	case models.RoleFollow:
+		rc.follow++
+	case models.RoleBoth:
+		rc.both++
+	}
+}
+
+// imbalance is the difference between leads and follows that people dancing
+// both roles can't make up for.
+func (rc roleCounts) imbalance() int {
+	d := rc.lead - rc.follow
+	if d < 0 {
+		d = -d
+	}
+
+	d -= rc.both
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+func (rc roleCounts) admits(role string, limits *eventLimits) bool {
+	if limits.Capacity.Int64 > 0 && int64(rc.total) >= limits.Capacity.Int64 {
+		return false
+	}
+
+	if limits.MaxRoleImbalance.Int64 <= 0 {
+		return true
+	}
+
+	next := rc
+	next.add(role)
+
+	return int64(next.imbalance()) <= limits.MaxRoleImbalance.Int64 || next.imbalance() < rc.imbalance()
+}
+
+func lockEventLimits(tx bun.Tx, eventID int64, ctx context.Context) (*eventLimits, error) {
+	limits := &eventLimits{}
+
+	err := tx.NewSelect().
+		Model((*Event)(nil)).
+		Column("capacity", "max_role_imbalance").
+		Where("id = ?", eventID).
+		For("UPDATE").
+		Scan(ctx, &limits.Capacity, &limits.MaxRoleImbalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
+
+// countGoingByRole counts the attendees of an occurrence, leaving out the
+// given user so that changing one's own answer isn't blocked by oneself.
+func countGoingByRole(tx bun.Tx, eventID int64, recurrenceID time.Time, exceptUserID int64, ctx context.Context) (roleCounts, error) {
+	var roles []string
+
+	err := tx.NewSelect().
+		Model((*RSVP)(nil)).
+		Column("role").
+		Where("event_id = ?", eventID).
+		Where("recurrence_id = ?", recurrenceID).
+		Where("user_id != ?", exceptUserID).
+		Where("status = ?", models.RSVPGoing).
+		Scan(ctx, &roles)
+	if err != nil {
+		return roleCounts{}, err
+	}
+
+	counts := roleCounts{}
+	for _, role := range roles {
+		counts.add(role)
+	}
+
+	return counts, nil
+}
+
+// promoteWaitlists promotes from the waitlist of every occurrence of an
+// event that has one, e.g. after its limits changed. It must be called with
+// the event row locked by lockEventLimits.
+func promoteWaitlists(tx bun.Tx, eventID int64, limits *eventLimits, ctx context.Context) error {
+	var recurrenceIDs []time.Time
+
+	err := tx.NewSelect().
+		Model((*RSVP)(nil)).
+		Distinct().
+		Column("recurrence_id").
+		Where("event_id = ?", eventID).
+		Where("status = ?", models.RSVPWaitlisted).
+		Scan(ctx, &recurrenceIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, recurrenceID := range recurrenceIDs {
+		err = promoteWaitlist(tx, eventID, recurrenceID, limits, ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// promoteWaitlist must be called with the event row locked by
+// lockEventLimits.
+func promoteWaitlist(tx bun.Tx, eventID int64, recurrenceID time.Time, limits *eventLimits, ctx context.Context) error {
+	counts, err := countGoingByRole(tx, eventID, recurrenceID, 0, ctx)
+	if err != nil {
+		return err
+	}
+
+	var waiting []RSVP
+
+	err = tx.NewSelect().
+		Model(&waiting).
+		Where("event_id = ?", eventID).
+		Where("recurrence_id = ?", recurrenceID).
+		Where("status = ?", models.RSVPWaitlisted).
+		Order("updated_at ASC", "user_id ASC").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	promoted := admitWaiting(counts, waiting, limits)
+	if len(promoted) == 0 {
+		return nil
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*RSVP)(nil)).
+		Set("status = ?", models.RSVPGoing).
+		Set("updated_at = ?", time.Now()).
+		Where("event_id = ?", eventID).
+		Where("recurrence_id = ?", recurrenceID).
+		Where("user_id IN (?)", bun.In(promoted)).
+		Exec(ctx)
+
+	return err
+}
+
+// admitWaiting returns the users on the waitlist that get a seat next to the
+// attendees counted. People are promoted in the order they joined the
+// waitlist, skipping those whose role would break the balance.
+func admitWaiting(counts roleCounts, waiting []RSVP, limits *eventLimits) []int64 {
+	promoted := make([]int64, 0, len(waiting))
+	for _, w := range waiting {
+		if !counts.admits(w.Role, limits) {
+			continue
+		}
+
+		counts.add(w.Role)
+		promoted = append(promoted, w.UserID)
+	}
+
+	return promoted
+}
+
+func (s *RSVPRepository) GetRSVPs(eventID int64, recurrenceID *time.Time, ctx context.Context) ([]*models.RSVP, error) {
+	var rsvps []RSVP
+
+	err := s.db.NewSelect().
+		Model(&rsvps).
+		Where("event_id = ?", eventID).
+		Where("recurrence_id = ?", recurrenceKey(recurrenceID)).
+		Order("updated_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mrs := make([]*models.RSVP, 0, len(rsvps))
+
+	for _, r := range rsvps {
+		mrs = append(mrs, r.toModel())
+	}
+
+	return mrs, nil
+}
+
+// GetRSVPCounts counts the answers for every occurrence of the events.
+func (s *RSVPRepository) GetRSVPCounts(eventIDs []int64, ctx context.Context) (map[models.OccurrenceKey]*models.RSVPCounts, error) {
+	counts := make(map[models.OccurrenceKey]*models.RSVPCounts, len(eventIDs))
+	if len(eventIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		EventID      int64
+		RecurrenceID time.Time
+		Status       string
+		Role         string
+		Count        int
+	}
+
+	err := s.db.NewSelect().
+		Model((*RSVP)(nil)).
+		Column("event_id", "recurrence_id", "status", "role").
+		ColumnExpr("count(*) AS count").
+		Where("event_id IN (?)", bun.In(eventIDs)).
+		Group("event_id", "recurrence_id", "status", "role").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		key := models.OccurrenceKey{EventID: row.EventID, RecurrenceID: row.RecurrenceID.UTC()}
+
+		c, ok := counts[key]
+		if !ok {
+			c = &models.RSVPCounts{}
+			counts[key] = c
+		}
+
+		switch row.Status {
+		case models.RSVPGoing:
+			c.Going += row.Count
+			switch row.Role {
+			case models.RoleLead:
+				c.GoingLeads += row.Count
+			case models.RoleFollow:
+				c.GoingFollows += row.Count
+			case models.RoleBoth:
+				c.GoingBoth += row.Count
+			}
+		case models.RSVPInterested:
+			c.Interested += row.Count
+		case models.RSVPNotGoing:
+			c.NotGoing += row.Count
+		case models.RSVPWaitlisted:
+			c.Waitlisted += row.Count
+		}
+	}
+
+	return counts, nil
+}
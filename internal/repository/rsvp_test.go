@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github/eventApp/internal/models"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdmitWaiting(t *testing.T) {
+	limited := func(capacity, maxRoleImbalance int64) *eventLimits {
+		return &eventLimits{
+			Capacity:         sql.NullInt64{Int64: capacity, Valid: true},
+			MaxRoleImbalance: sql.NullInt64{Int64: maxRoleImbalance, Valid: true},
+		}
+	}
+
+	waiting := []RSVP{
+		{UserID: 1, Role: models.RoleLead},
+		{UserID: 2, Role: models.RoleLead},
+		{UserID: 3, Role: models.RoleFollow},
+		{UserID: 4, Role: models.RoleFollow},
+	}
+
+	tests := []struct {
+		name   string
+		counts roleCounts
+		limits *eventLimits
+		want   []int64
+	}{
+		{
+			name:   "seats in queue order",
+			counts: roleCounts{total: 8},
+			limits: limited(10, 0),
+			want:   []int64{1, 2},
+		},
+		{
+			name:   "full",
+			counts: roleCounts{total: 10},
+			limits: limited(10, 0),
+			want:   []int64{},
+		},
+		{
+			name:   "no limits",
+			limits: limited(0, 0),
+			want:   []int64{1, 2, 3, 4},
+		},
+		{
+			name:   "skips roles breaking the balance",
+			counts: roleCounts{total: 2, lead: 2},
+			limits: limited(0, 1),
+			want:   []int64{3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := admitWaiting(tt.counts, waiting, tt.limits)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestEvent creates an event with the given capacity, removed again when
+// the test ends.
+func newTestEvent(t *testing.T, events *EventRepository, capacity int, recurrence *models.Recurrence) *models.Event {
+	ctx := context.Background()
+
+	event, err := events.CreateEvent(&models.Event{
+		Name:       "RSVP test social",
+		GroupID:    1,
+		Time:       time.Date(2026, 6, 5, 19, 0, 0, 0, time.UTC),
+		Capacity:   capacity,
+		Timezone:   "UTC",
+		Recurrence: recurrence,
+	}, ctx)
+	if err != nil {
+		t.Fatalf("creating event: %v", err)
+	}
+	t.Cleanup(func() { events.DeleteEvent(event.ID, ctx) })
+
+	return event
+}
+
+func statuses(t *testing.T, rsvps *RSVPRepository, eventID int64, recurrenceID *time.Time) map[int64]string {
+	got, err := rsvps.GetRSVPs(eventID, recurrenceID, context.Background())
+	if err != nil {
+		t.Fatalf("fetching rsvps: %v", err)
+	}
+
+	byUser := make(map[int64]string, len(got))
+	for _, r := range got {
+		byUser[r.UserID] = r.Status
+	}
+	return byUser
+}
+
+func TestConcurrentRSVPsRespectCapacity(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	events, err := NewEventRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating event repository: %v", err)
+	}
+	rsvps, err := NewRSVPRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating rsvp repository: %v", err)
+	}
+
+	event := newTestEvent(t, events, 3, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for userID := int64(1); userID <= 20; userID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rsvps.SetRSVP(&models.RSVP{EventID: event.ID, UserID: userID, Status: models.RSVPGoing}, ctx)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("rsvp: %v", err)
+		}
+	}
+
+	going := 0
+	for _, status := range statuses(t, rsvps, event.ID, nil) {
+		if status == models.RSVPGoing {
+			going++
+		}
+	}
+
+	if going != 3 {
+		t.Errorf("%d going with a capacity of 3", going)
+	}
+}
+
+func TestWaitlistPromotion(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	events, err := NewEventRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating event repository: %v", err)
+	}
+	rsvps, err := NewRSVPRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating rsvp repository: %v", err)
+	}
+
+	event := newTestEvent(t, events, 1, nil)
+
+	for userID := int64(1); userID <= 3; userID++ {
+		_, err := rsvps.SetRSVP(&models.RSVP{EventID: event.ID, UserID: userID, Status: models.RSVPGoing}, ctx)
+		if err != nil {
+			t.Fatalf("rsvp: %v", err)
+		}
+	}
+
+	err = rsvps.RemoveRSVP(event.ID, nil, 1, ctx)
+	if err != nil {
+		t.Fatalf("removing rsvp: %v", err)
+	}
+
+	got := statuses(t, rsvps, event.ID, nil)
+	if got[2] != models.RSVPGoing || got[3] != models.RSVPWaitlisted {
+		t.Errorf("after leaving got %v, want user 2 promoted and user 3 waiting", got)
+	}
+
+	// Raising the capacity promotes in the same transaction.
+	event.Capacity = 2
+	_, err = events.UpdateEvent(event.ID, event, ctx)
+	if err != nil {
+		t.Fatalf("raising capacity: %v", err)
+	}
+
+	if got := statuses(t, rsvps, event.ID, nil); got[3] != models.RSVPGoing {
+		t.Errorf("after raising the capacity got %v, want user 3 promoted", got)
+	}
+}
+
+func TestRSVPsPerOccurrence(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	events, err := NewEventRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating event repository: %v", err)
+	}
+	rsvps, err := NewRSVPRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating rsvp repository: %v", err)
+	}
+
+	event := newTestEvent(t, events, 1, &models.Recurrence{RRule: "FREQ=WEEKLY"})
+	first := event.Time
+	second := first.Add(7 * 24 * time.Hour)
+
+	for _, rsvp := range []*models.RSVP{
+		{EventID: event.ID, RecurrenceID: &first, UserID: 1, Status: models.RSVPGoing},
+		{EventID: event.ID, RecurrenceID: &second, UserID: 2, Status: models.RSVPGoing},
+		{EventID: event.ID, RecurrenceID: &second, UserID: 3, Status: models.RSVPGoing},
+	} {
+		_, err := rsvps.SetRSVP(rsvp, ctx)
+		if err != nil {
+			t.Fatalf("rsvp: %v", err)
+		}
+	}
+
+	if got := statuses(t, rsvps, event.ID, &first); got[1] != models.RSVPGoing {
+		t.Errorf("first occurrence got %v, want user 1 going", got)
+	}
+
+	if got := statuses(t, rsvps, event.ID, &second); got[2] != models.RSVPGoing || got[3] != models.RSVPWaitlisted {
+		t.Errorf("second occurrence got %v, want its own seat for user 2 and user 3 waiting", got)
+	}
+
+	counts, err := rsvps.GetRSVPCounts([]int64{event.ID}, ctx)
+	if err != nil {
+		t.Fatalf("counting rsvps: %v", err)
+	}
+
+	if c := counts[models.OccurrenceKey{EventID: event.ID, RecurrenceID: second}]; c == nil || c.Going != 1 || c.Waitlisted != 1 {
+		t.Errorf("second occurrence counts %+v, want 1 going and 1 waitlisted", c)
+	}
+}
@@ -19,6 +19,8 @@ type User struct {
 	Email    string `bun:",notnull,unique"`
 	UserName string `bun:",notnull,unique"`
 	Password string `bun:",notnull"`
+
+	CalendarToken string `bun:",unique,nullzero"`
 }
 
 func NewUserRepository(db *bun.DB, ctx context.Context) (*UserRepository, error) {
@@ -36,6 +38,11 @@ func (s *UserRepository) createUserTable(ctx context.Context) error {
 		return err
 	}
 
+	_, err = s.db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN IF NOT EXISTS calendar_token varchar UNIQUE")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -74,7 +81,7 @@ func (s *UserRepository) UpdateUser(id int64, user *models.User, ctx context.Con
 
 	updatedUser := &User{}
 
-	err := s.db.NewUpdate().Model(us).Where("id = ?", id).Returning("*").Scan(ctx, updatedUser)
+	err := s.db.NewUpdate().Model(us).Column("name", "email").Where("id = ?", id).Returning("*").Scan(ctx, updatedUser)
 	if err != nil {
 		return nil, err
 	}
@@ -125,3 +132,23 @@ func (s *UserRepository) GetUserByUserName(userName string, ctx context.Context)
 
 	return ud, nil
 }
+
+func (s *UserRepository) SetCalendarToken(id int64, token string, ctx context.Context) error {
+	_, err := s.db.NewUpdate().Model((*User)(nil)).Set("calendar_token = ?", token).Where("id = ?", id).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserRepository) GetUserIDByCalendarToken(token string, ctx context.Context) (int64, error) {
+	var id int64
+
+	err := s.db.NewSelect().Model((*User)(nil)).Column("id").Where("calendar_token = ?", token).Scan(ctx, &id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+func TestUpdateUserKeepsCalendarToken(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	users, err := NewUserRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating user repository: %v", err)
+	}
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	user, err := users.CreateUser(&models.User{
+		Name:     "Token test " + suffix,
+		Email:    "token-" + suffix + "@example.com",
+		UserName: "token-" + suffix,
+		Password: "hash",
+	}, ctx)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	t.Cleanup(func() { db.NewDelete().Model((*User)(nil)).Where("id = ?", user.ID).Exec(ctx) })
+
+	token := "token-" + suffix
+	err = users.SetCalendarToken(user.ID, token, ctx)
+	if err != nil {
+		t.Fatalf("setting calendar token: %v", err)
+	}
+
+	updated, err := users.UpdateUser(user.ID, &models.User{Name: "Renamed " + suffix, Email: "renamed-" + suffix + "@example.com"}, ctx)
+	if err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+
+	if updated.Name != "Renamed "+suffix || updated.UserName != user.UserName {
+		t.Errorf("got name %q and user name %q, want the new name and the old user name", updated.Name, updated.UserName)
+	}
+
+	id, err := users.GetUserIDByCalendarToken(token, ctx)
+	if err != nil || id != user.ID {
+		t.Errorf("calendar token resolves to user %d (%v) after the update, want %d", id, err, user.ID)
+	}
+
+	stored, err := users.GetUserByUserName(user.UserName, ctx)
+	if err != nil || stored.Password != "hash" {
+		t.Errorf("password not kept by the update: %v", err)
+	}
+}
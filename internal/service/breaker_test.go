@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cooldown := 20 * time.Millisecond
+	b := newCircuitBreaker(2, cooldown)
+
+	b.failure()
+	if !b.allow() {
+		t.Fatalf("open after one failure, want open after two")
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Fatalf("closed after two failures")
+	}
+
+	time.Sleep(cooldown)
+
+	if !b.allow() {
+		t.Fatalf("no probe let through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatalf("second call let through while probing")
+	}
+
+	// A failed probe opens the breaker for another cooldown.
+	b.failure()
+	if b.allow() {
+		t.Fatalf("closed after a failed probe")
+	}
+
+	time.Sleep(cooldown)
+
+	if !b.allow() {
+		t.Fatalf("no probe let through after the second cooldown")
+	}
+
+	b.success()
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("open after a successful probe")
+		}
+	}
+
+	// Failures only count when consecutive.
+	b.failure()
+	b.success()
+	b.failure()
+	if !b.allow() {
+		t.Fatalf("open after failures that weren't consecutive")
+	}
+}
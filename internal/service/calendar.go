@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// calendarLookback is how far into the past calendar feeds go, so that
+// subscribers still see recent events.
+const calendarLookback = 30 * 24 * time.Hour
+
+func (e *EventService) GroupCalendar(groupID int64, ctx context.Context) (string, error) {
+	from := time.Now().Add(-calendarLookback)
+
+	events, err := e.GetEvents(groupID, from, time.Time{}, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	cal := newCalendar(fmt.Sprintf("Group %d events", groupID))
+	for _, event := range events {
+		addCalendarEvent(cal, event)
+	}
+
+	return cal.Serialize(), nil
+}
+
+func (e *EventService) UserCalendar(userID int64, ctx context.Context) (string, error) {
+	from := time.Now().Add(-calendarLookback)
+
+	series, err := e.eventRep.GetEventsForUser(userID, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	events, err := expandAll(series, from, from.Add(recurrenceHorizon))
+	if err != nil {
+		return "", err
+	}
+
+	cal := newCalendar("My events")
+	for _, event := range events {
+		addCalendarEvent(cal, newGetEventResponse(event))
+	}
+
+	return cal.Serialize(), nil
+}
+
+func newCalendar(name string) *ics.Calendar {
+	cal := ics.NewCalendarFor("eventApp")
+	cal.SetMethod(ics.MethodPublish)
+	cal.SetName(name)
+	cal.SetXWRCalName(name)
+	cal.SetRefreshInterval("PT1H")
+
+	return cal
+}
+
+func addCalendarEvent(cal *ics.Calendar, event *GetEventResponse) {
+	uid := fmt.Sprintf("event-%d@eventapp", event.ID)
+	if event.RecurrenceID != nil {
+		uid = fmt.Sprintf("event-%d-%s@eventapp", event.ID, event.RecurrenceID.UTC().Format("20060102T150405Z"))
+	}
+
+	ve := cal.AddEvent(uid)
+	ve.SetDtStampTime(time.Now())
+	ve.SetStartAt(event.Time)
+	ve.SetSummary(event.Name)
+	ve.SetLocation(event.Location)
+	ve.SetGeo(event.Latitude, event.Longitude)
+
+	if event.Cancelled {
+		ve.SetStatus(ics.ObjectStatusCancelled)
+	}
+
+	categories := append([]string{}, event.DanceStyles...)
+	if event.Type != "" {
+		categories = append(categories, event.Type)
+	}
+
+	// One property per category, the library escapes commas within a value.
+	for _, category := range categories {
+		ve.AddCategory(category)
+	}
+}
+
+func expandAll(series []*models.Event, from, to time.Time) ([]*models.Event, error) {
+	events := make([]*models.Event, 0, len(series))
+
+	for _, event := range series {
+		occurrences, err := expandOccurrences(event, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, occurrences...)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,642 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// maxCalendarFeedSize limits fetched feeds to 10 MB.
+const maxCalendarFeedSize = 10 << 20
+
+// nonPublicPrefixes are the special purpose ranges not covered by the
+// net/netip checks in publicAddressOnly.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// NewCalendarFeedClient returns the client feeds are fetched with. Feed URLs
+// come from users, so it only connects to public addresses, checked after
+// name resolution and on every redirect, and never goes through a proxy.
+func NewCalendarFeedClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: publicAddressOnly,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// publicAddressOnly is a net.Dialer Control hook refusing connections to
+// loopback, private, link-local and other non-public addresses.
+func publicAddressOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+
+	public := ip.IsGlobalUnicast() && !ip.IsPrivate()
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			public = false
+		}
+	}
+
+	if !public {
+		return fmt.Errorf("calendar feeds can't be fetched from non-public address %s", ip)
+	}
+
+	return nil
+}
+
+type calendarImportRep interface {
+	CreateImport(calendarImport *models.CalendarImport, ctx context.Context) (*models.CalendarImport, error)
+	GetImports(groupID int64, ctx context.Context) ([]*models.CalendarImport, error)
+	GetURLImports(ctx context.Context) ([]*models.CalendarImport, error)
+	MarkSynced(id int64, syncErr string, ctx context.Context) error
+}
+
+type importedEventRep interface {
+	GetEventsByImport(importID int64, ctx context.Context) ([]*models.Event, error)
+}
+
+type CalendarImportService struct {
+	importRep   calendarImportRep
+	eventRep    importedEventRep
+	eventWriter *EventService
+	client      *http.Client
+}
+
+func NewCalendarImportService(importRep calendarImportRep, eventRep importedEventRep, eventWriter *EventService, client *http.Client) *CalendarImportService {
+	return &CalendarImportService{
+		importRep,
+		eventRep,
+		eventWriter,
+		client,
+	}
+}
+
+type CreateCalendarImportRequest struct {
+	GroupID int64  `json:"groupId"`
+	URL     string `json:"url"`
+}
+
+type CalendarImportResponse struct {
+	ID           int64     `json:"id"`
+	GroupID      int64     `json:"groupId"`
+	URL          string    `json:"url,omitempty"`
+	LastSyncedAt time.Time `json:"lastSyncedAt"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+func newCalendarImportResponse(ci *models.CalendarImport) *CalendarImportResponse {
+	return &CalendarImportResponse{
+		ID:           ci.ID,
+		GroupID:      ci.GroupID,
+		URL:          ci.URL,
+		LastSyncedAt: ci.LastSyncedAt,
+		LastError:    ci.LastError,
+	}
+}
+
+// CreateImport registers a feed URL for the group and syncs it right away.
+func (s *CalendarImportService) CreateImport(ccir *CreateCalendarImportRequest, ctx context.Context) (*CalendarImportResponse, error) {
+
+	if !strings.HasPrefix(ccir.URL, "http://") && !strings.HasPrefix(ccir.URL, "https://") {
+		return nil, models.Invalidf("calendar url must be http or https")
+	}
+
+	cal, err := s.fetchCalendar(ccir.URL, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	createdImport, err := s.importRep.CreateImport(&models.CalendarImport{
+		GroupID: ccir.GroupID,
+		URL:     ccir.URL,
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.syncCalendar(createdImport, cal, ctx)
+}
+
+// UploadCalendar imports the events of an uploaded .ics file once.
+func (s *CalendarImportService) UploadCalendar(groupID int64, r io.Reader, ctx context.Context) (*CalendarImportResponse, error) {
+
+	cal, err := ics.ParseCalendar(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing calendar: %v", err)
+	}
+
+	createdImport, err := s.importRep.CreateImport(&models.CalendarImport{
+		GroupID: groupID,
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.syncCalendar(createdImport, cal, ctx)
+}
+
+func (s *CalendarImportService) GetImports(groupID int64, ctx context.Context) ([]*CalendarImportResponse, error) {
+
+	imports, err := s.importRep.GetImports(groupID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	importsResp := make([]*CalendarImportResponse, 0, len(imports))
+
+	for _, ci := range imports {
+		importsResp = append(importsResp, newCalendarImportResponse(ci))
+	}
+
+	return importsResp, nil
+}
+
+// Run syncs all registered feeds every interval until ctx is done.
+func (s *CalendarImportService) Run(interval time.Duration, ctx context.Context) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SyncAll(ctx)
+		}
+	}
+}
+
+func (s *CalendarImportService) SyncAll(ctx context.Context) {
+	imports, err := s.importRep.GetURLImports(ctx)
+	if err != nil {
+		log.Printf("error fetching calendar imports: %v", err)
+		return
+	}
+
+	for _, ci := range imports {
+		cal, err := s.fetchCalendar(ci.URL, ctx)
+		if err != nil {
+			log.Printf("error fetching calendar import %d: %v", ci.ID, err)
+
+			err = s.importRep.MarkSynced(ci.ID, err.Error(), ctx)
+			if err != nil {
+				log.Printf("error marking calendar import %d as synced: %v", ci.ID, err)
+			}
+			continue
+		}
+
+		synced, err := s.syncCalendar(ci, cal, ctx)
+		if err != nil {
+			log.Printf("error syncing calendar import %d: %v", ci.ID, err)
+			continue
+		}
+
+		if synced.LastError != "" {
+			log.Printf("calendar import %d synced with errors: %s", ci.ID, synced.LastError)
+		}
+	}
+}
+
+func (s *CalendarImportService) fetchCalendar(url string, ctx context.Context) (*ics.Calendar, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching calendar: unexpected status %s", resp.Status)
+	}
+
+	// Reading one byte past the limit tells a feed that is too large from
+	// one that is exactly as large as allowed.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %v", err)
+	}
+
+	if len(data) > maxCalendarFeedSize {
+		return nil, fmt.Errorf("error fetching calendar: larger than %d bytes", maxCalendarFeedSize)
+	}
+
+	cal, err := ics.ParseCalendar(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing calendar: %v", err)
+	}
+
+	return cal, nil
+}
+
+// syncCalendar makes the events of an import match the calendar, matching
+// them by VEVENT UID: new UIDs are created, known ones updated and missing
+// ones removed. Events that can't be imported are skipped and reported in
+// the import's LastError, the rest of the calendar is still synced.
+func (s *CalendarImportService) syncCalendar(ci *models.CalendarImport, cal *ics.Calendar, ctx context.Context) (*CalendarImportResponse, error) {
+
+	skipped, syncErr := s.applyCalendar(ci, cal, ctx)
+
+	errString := strings.Join(skipped, "; ")
+	if syncErr != nil {
+		errString = syncErr.Error()
+	}
+
+	err := s.importRep.MarkSynced(ci.ID, errString, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	ci.LastSyncedAt = time.Now()
+	ci.LastError = errString
+
+	return newCalendarImportResponse(ci), nil
+}
+
+// applyCalendar returns why events were skipped, and an error only when the
+// calendar couldn't be synced at all.
+func (s *CalendarImportService) applyCalendar(ci *models.CalendarImport, cal *ics.Calendar, ctx context.Context) ([]string, error) {
+
+	parsed, unreadable := parseCalendarEvents(cal)
+
+	existing, err := s.eventRep.GetEventsByImport(ci.ID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existingByUID := make(map[string]*models.Event, len(existing))
+	for _, event := range existing {
+		existingByUID[event.ExternalUID] = event
+	}
+
+	// Events that are in the feed but couldn't be read are kept as they
+	// were imported before.
+	var skipped []string
+	for _, se := range unreadable {
+		delete(existingByUID, se.uid)
+		skipped = append(skipped, se.err.Error())
+	}
+
+	for _, event := range parsed {
+		event.GroupID = ci.GroupID
+
+		// Compared in the form they are saved in, so categories spelled
+		// differently from the taxonomy don't update events on every sync.
+		event.DanceStyles, err = s.eventWriter.NormalizeDanceStyles(event.DanceStyles, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		current, ok := existingByUID[event.ExternalUID]
+		delete(existingByUID, event.ExternalUID)
+
+		if !ok {
+			_, err = s.eventWriter.CreateEvent(&CreateEventRequest{
+				Name:        event.Name,
+				GroupID:     event.GroupID,
+				Time:        event.Time,
+				Latitude:    event.Latitude,
+				Longitude:   event.Longitude,
+				Location:    event.Location,
+				DanceStyles: event.DanceStyles,
+				Timezone:    event.Timezone,
+				Recurrence:  recurrenceFromModel(event.Recurrence),
+				ImportID:    ci.ID,
+				ExternalUID: event.ExternalUID,
+			}, ctx)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("error creating event %q: %v", event.ExternalUID, err))
+			}
+			continue
+		}
+
+		if sameImportedEvent(current, event) {
+			continue
+		}
+
+		// The feed can move an event without knowing its type, details
+		// that no longer fit, like an end time before the new start, are
+		// dropped instead of failing the sync.
+		kind := &models.Event{
+			Time:    event.Time,
+			Type:    current.Type,
+			Details: eventDetailsToModel(eventDetailsFromModel(current.Details)),
+		}
+		fitEventKind(kind)
+
+		// Fields the feed doesn't carry are kept as they were set here.
+		_, err = s.eventWriter.UpdateEvent(ci.GroupID, current.ID, &UpdateEventRequest{
+			Name:             event.Name,
+			GroupID:          event.GroupID,
+			Time:             event.Time,
+			Latitude:         event.Latitude,
+			Longitude:        event.Longitude,
+			Location:         event.Location,
+			DanceStyles:      event.DanceStyles,
+			Type:             kind.Type,
+			Levels:           current.Levels,
+			Details:          eventDetailsFromModel(kind.Details),
+			Capacity:         current.Capacity,
+			MaxRoleImbalance: current.MaxRoleImbalance,
+			Timezone:         event.Timezone,
+			Recurrence:       recurrenceFromModel(event.Recurrence),
+		}, ctx)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("error updating event %q: %v", event.ExternalUID, err))
+		}
+	}
+
+	for uid, event := range existingByUID {
+		err = s.eventWriter.DeleteEvent(ci.GroupID, event.ID, ctx)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("error removing event %q: %v", uid, err))
+		}
+	}
+
+	return skipped, nil
+}
+
+func sameImportedEvent(a, b *models.Event) bool {
+	if a.Name != b.Name || !a.Time.Equal(b.Time) || a.Location != b.Location ||
+		a.Latitude != b.Latitude || a.Longitude != b.Longitude || a.Timezone != b.Timezone ||
+		strings.Join(a.DanceStyles, ",") != strings.Join(b.DanceStyles, ",") {
+		return false
+	}
+
+	if (a.Recurrence == nil) != (b.Recurrence == nil) {
+		return false
+	}
+
+	if a.Recurrence == nil {
+		return true
+	}
+
+	return a.Recurrence.RRule == b.Recurrence.RRule &&
+		slices.EqualFunc(a.Recurrence.ExDates, b.Recurrence.ExDates, time.Time.Equal) &&
+		slices.EqualFunc(a.Recurrence.Overrides, b.Recurrence.Overrides, sameOverride)
+}
+
+// sameOverride compares the fields a feed sets on an override.
+func sameOverride(a, b models.OccurrenceOverride) bool {
+	if !a.RecurrenceID.Equal(b.RecurrenceID) {
+		return false
+	}
+
+	if (a.Time == nil) != (b.Time == nil) || a.Time != nil && !a.Time.Equal(*b.Time) {
+		return false
+	}
+
+	return sameString(a.Name, b.Name) && sameString(a.Location, b.Location)
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// skippedEvent is a VEVENT that couldn't be read, uid is empty when the
+// VEVENT had none.
+type skippedEvent struct {
+	uid string
+	err error
+}
+
+// parseCalendarEvents turns the VEVENTs of a calendar into events keyed by
+// UID. VEVENTs with a RECURRENCE-ID become overrides of their series. VEVENTs
+// that can't be read are skipped, together with their series if they are an
+// override, so a series is never imported without some of its overrides.
+func parseCalendarEvents(cal *ics.Calendar) ([]*models.Event, []skippedEvent) {
+	var events []*models.Event
+	var skipped []skippedEvent
+	byUID := make(map[string]*models.Event)
+	var exceptions []*ics.VEvent
+
+	for _, ve := range cal.Events() {
+		if ve.GetProperty(ics.ComponentPropertyRecurrenceId) != nil {
+			exceptions = append(exceptions, ve)
+			continue
+		}
+
+		event, err := parseCalendarEvent(ve)
+		if err != nil {
+			skipped = append(skipped, skippedEvent{ve.Id(), err})
+			continue
+		}
+
+		events = append(events, event)
+		byUID[event.ExternalUID] = event
+	}
+
+	for _, ve := range exceptions {
+		series, ok := byUID[ve.Id()]
+		if !ok || series.Recurrence == nil {
+			continue
+		}
+
+		override, err := parseOverride(ve)
+		if err != nil {
+			skipped = append(skipped, skippedEvent{ve.Id(), err})
+			delete(byUID, ve.Id())
+			continue
+		}
+
+		series.Recurrence.Overrides = append(series.Recurrence.Overrides, override)
+	}
+
+	events = slices.DeleteFunc(events, func(event *models.Event) bool {
+		return byUID[event.ExternalUID] != event
+	})
+
+	return events, skipped
+}
+
+func parseCalendarEvent(ve *ics.VEvent) (*models.Event, error) {
+	uid := ve.Id()
+	if uid == "" {
+		return nil, fmt.Errorf("calendar event without UID")
+	}
+
+	start := ve.GetProperty(ics.ComponentPropertyDtStart)
+	if start == nil {
+		return nil, fmt.Errorf("calendar event %q has no start", uid)
+	}
+
+	startTime, err := parseICalTime(start.Value, start.ICalParameters)
+	if err != nil {
+		return nil, fmt.Errorf("calendar event %q: %v", uid, err)
+	}
+
+	event := &models.Event{
+		Name:        propertyValue(ve, ics.ComponentPropertySummary),
+		Time:        startTime,
+		Location:    propertyValue(ve, ics.ComponentPropertyLocation),
+		ExternalUID: uid,
+	}
+
+	if tzid, ok := start.ICalParameters["TZID"]; ok && len(tzid) == 1 {
+		event.Timezone = tzid[0]
+	}
+
+	if geo := propertyValue(ve, ics.ComponentPropertyGeo); geo != "" {
+		event.Latitude, event.Longitude, err = parseGeo(geo)
+		if err != nil {
+			return nil, fmt.Errorf("calendar event %q: %v", uid, err)
+		}
+	}
+
+	for _, c := range ve.GetProperties(ics.ComponentPropertyCategories) {
+		for _, category := range strings.Split(c.Value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				event.DanceStyles = append(event.DanceStyles, category)
+			}
+		}
+	}
+
+	if rule := propertyValue(ve, ics.ComponentPropertyRrule); rule != "" {
+		if event.Timezone == "" {
+			event.Timezone = "UTC"
+		}
+
+		event.Recurrence = &models.Recurrence{
+			RRule: rule,
+		}
+
+		for _, exDate := range ve.GetProperties(ics.ComponentPropertyExdate) {
+			for _, value := range strings.Split(exDate.Value, ",") {
+				t, err := parseICalTime(value, exDate.ICalParameters)
+				if err != nil {
+					return nil, fmt.Errorf("calendar event %q: %v", uid, err)
+				}
+
+				event.Recurrence.ExDates = append(event.Recurrence.ExDates, t)
+			}
+		}
+	}
+
+	return event, nil
+}
+
+func parseOverride(ve *ics.VEvent) (models.OccurrenceOverride, error) {
+	rid := ve.GetProperty(ics.ComponentPropertyRecurrenceId)
+	recurrenceID, err := parseICalTime(rid.Value, rid.ICalParameters)
+	if err != nil {
+		return models.OccurrenceOverride{}, fmt.Errorf("calendar event %q: %v", ve.Id(), err)
+	}
+
+	override := models.OccurrenceOverride{
+		RecurrenceID: recurrenceID,
+	}
+
+	if start := ve.GetProperty(ics.ComponentPropertyDtStart); start != nil {
+		t, err := parseICalTime(start.Value, start.ICalParameters)
+		if err != nil {
+			return models.OccurrenceOverride{}, fmt.Errorf("calendar event %q: %v", ve.Id(), err)
+		}
+		override.Time = &t
+	}
+
+	if summary := ve.GetProperty(ics.ComponentPropertySummary); summary != nil {
+		override.Name = &summary.Value
+	}
+
+	if location := ve.GetProperty(ics.ComponentPropertyLocation); location != nil {
+		override.Location = &location.Value
+	}
+
+	return override, nil
+}
+
+func propertyValue(ve *ics.VEvent, property ics.ComponentProperty) string {
+	p := ve.GetProperty(property)
+	if p == nil {
+		return ""
+	}
+
+	return p.Value
+}
+
+func parseGeo(geo string) (float64, float64, error) {
+	parts := strings.Split(geo, ";")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid GEO %q", geo)
+	}
+
+	lat, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid GEO %q", geo)
+	}
+
+	long, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid GEO %q", geo)
+	}
+
+	return lat, long, nil
+}
+
+// parseICalTime parses UTC, zoned (TZID) and floating DATE-TIME values as well
+// as DATE values. Floating values without a TZID are taken as UTC.
+func parseICalTime(value string, params map[string][]string) (time.Time, error) {
+	loc := time.UTC
+	if tzid, ok := params["TZID"]; ok && len(tzid) == 1 {
+		var err error
+		loc, err = time.LoadLocation(tzid[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid[0])
+		}
+	}
+
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date-time %q", value)
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeImportRep keeps calendar imports in memory.
+type fakeImportRep struct {
+	imports []*models.CalendarImport
+}
+
+func (f *fakeImportRep) CreateImport(calendarImport *models.CalendarImport, ctx context.Context) (*models.CalendarImport, error) {
+	calendarImport.ID = int64(len(f.imports) + 1)
+	f.imports = append(f.imports, calendarImport)
+	return calendarImport, nil
+}
+
+func (f *fakeImportRep) GetImports(groupID int64, ctx context.Context) ([]*models.CalendarImport, error) {
+	var imports []*models.CalendarImport
+	for _, ci := range f.imports {
+		if ci.GroupID == groupID {
+			imports = append(imports, ci)
+		}
+	}
+	return imports, nil
+}
+
+func (f *fakeImportRep) GetURLImports(ctx context.Context) ([]*models.CalendarImport, error) {
+	var imports []*models.CalendarImport
+	for _, ci := range f.imports {
+		if ci.URL != "" {
+			imports = append(imports, ci)
+		}
+	}
+	return imports, nil
+}
+
+func (f *fakeImportRep) MarkSynced(id int64, syncErr string, ctx context.Context) error {
+	for _, ci := range f.imports {
+		if ci.ID == id {
+			ci.LastSyncedAt = time.Now()
+			ci.LastError = syncErr
+		}
+	}
+	return nil
+}
+
+// fakeEventStore keeps events in memory. Only the methods the calendar import
+// uses are implemented, the embedded interface panics on the others.
+type fakeEventStore struct {
+	eventRep
+	events map[int64]*models.Event
+	nextID int64
+}
+
+func newFakeEventStore() *fakeEventStore {
+	return &fakeEventStore{events: make(map[int64]*models.Event)}
+}
+
+func (f *fakeEventStore) CreateEvent(event *models.Event, ctx context.Context) (*models.Event, error) {
+	f.nextID++
+	event.ID = f.nextID
+	f.events[event.ID] = event
+	return event, nil
+}
+
+func (f *fakeEventStore) UpdateEvent(id int64, event *models.Event, ctx context.Context) (*models.Event, error) {
+	current, ok := f.events[id]
+	if !ok {
+		return nil, fmt.Errorf("event %d not found", id)
+	}
+
+	event.ID = id
+	event.ImportID = current.ImportID
+	event.ExternalUID = current.ExternalUID
+	f.events[id] = event
+	return event, nil
+}
+
+func (f *fakeEventStore) GetEvent(id int64, ctx context.Context) (*models.Event, error) {
+	event, ok := f.events[id]
+	if !ok {
+		return nil, fmt.Errorf("event %d not found", id)
+	}
+	return event, nil
+}
+
+func (f *fakeEventStore) GetAllEvents(ctx context.Context) ([]*models.Event, error) {
+	events := make([]*models.Event, 0, len(f.events))
+	for _, event := range f.events {
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (f *fakeEventStore) DeleteEvent(id int64, ctx context.Context) error {
+	delete(f.events, id)
+	return nil
+}
+
+func (f *fakeEventStore) GetEventsByImport(importID int64, ctx context.Context) ([]*models.Event, error) {
+	var events []*models.Event
+	for _, event := range f.events {
+		if event.ImportID == importID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeEventStore) byUID(uid string) *models.Event {
+	for _, event := range f.events {
+		if event.ExternalUID == uid {
+			return event
+		}
+	}
+	return nil
+}
+
+// feedServer serves an .ics feed that tests can change between syncs.
+type feedServer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (f *feedServer) set(events ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = events
+}
+
+func (f *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/calendar")
+	fmt.Fprint(w, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n")
+	for _, event := range f.events {
+		fmt.Fprint(w, event)
+	}
+	fmt.Fprint(w, "END:VCALENDAR\r\n")
+}
+
+func vevent(uid, summary, start string) string {
+	return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:20260101T000000Z\r\nDTSTART:" + start +
+		"\r\nSUMMARY:" + summary + "\r\nEND:VEVENT\r\n"
+}
+
+func TestCalendarImportSyncsByUID(t *testing.T) {
+	ctx := context.Background()
+
+	feed := &feedServer{}
+	feed.set(
+		vevent("social@example.com", "Friday social", "20260605T190000Z"),
+		vevent("class@example.com", "Beginner class", "20260606T180000Z"),
+	)
+
+	srv := httptest.NewServer(feed)
+	defer srv.Close()
+
+	importRep := &fakeImportRep{}
+	events := newFakeEventStore()
+	s := NewCalendarImportService(importRep, events, NewEventService(events, nil, nil), srv.Client())
+
+	created, err := s.CreateImport(&CreateCalendarImportRequest{GroupID: 7, URL: srv.URL}, ctx)
+	if err != nil {
+		t.Fatalf("CreateImport: %v", err)
+	}
+
+	if len(events.events) != 2 {
+		t.Fatalf("got %d events after create, want 2", len(events.events))
+	}
+
+	social := events.byUID("social@example.com")
+	if social == nil || social.Name != "Friday social" || social.GroupID != 7 || social.ImportID != created.ID {
+		t.Fatalf("social not created as imported event of group 7: %+v", social)
+	}
+	socialID := social.ID
+
+	feed.set(
+		vevent("social@example.com", "Friday social, moved", "20260605T200000Z"),
+		vevent("workshop@example.com", "Styling workshop", "20260607T120000Z"),
+	)
+
+	s.SyncAll(ctx)
+
+	if importRep.imports[0].LastError != "" {
+		t.Fatalf("sync failed: %s", importRep.imports[0].LastError)
+	}
+
+	social = events.byUID("social@example.com")
+	if social == nil || social.ID != socialID {
+		t.Fatalf("social wasn't updated in place: %+v", social)
+	}
+
+	if social.Name != "Friday social, moved" || !social.Time.Equal(time.Date(2026, 6, 5, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("social not updated: name %q, time %v", social.Name, social.Time)
+	}
+
+	if events.byUID("class@example.com") != nil {
+		t.Errorf("class missing from the feed wasn't deleted")
+	}
+
+	if events.byUID("workshop@example.com") == nil {
+		t.Errorf("workshop new in the feed wasn't created")
+	}
+
+	if len(events.events) != 2 {
+		t.Errorf("got %d events after sync, want 2", len(events.events))
+	}
+}
+
+func TestCalendarImportRejectsOversizedFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("X", maxCalendarFeedSize+1))
+	}))
+	defer srv.Close()
+
+	events := newFakeEventStore()
+	s := NewCalendarImportService(&fakeImportRep{}, events, NewEventService(events, nil, nil), srv.Client())
+
+	_, err := s.CreateImport(&CreateCalendarImportRequest{GroupID: 7, URL: srv.URL}, context.Background())
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("got error %v, want feed size error", err)
+	}
+}
+
+func TestCalendarFeedClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("feed client reached loopback server")
+	}))
+	defer srv.Close()
+
+	_, err := NewCalendarFeedClient(time.Second).Get(srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Fatalf("got error %v, want non-public address error", err)
+	}
+}
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::1]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+	}
+
+	for _, tt := range tests {
+		err := publicAddressOnly("tcp", tt.address, nil)
+		if (err == nil) != tt.public {
+			t.Errorf("publicAddressOnly(%q) = %v, want public %v", tt.address, err, tt.public)
+		}
+	}
+}
+
+func TestCalendarImportDropsStaleDetails(t *testing.T) {
+	ctx := context.Background()
+
+	feed := &feedServer{}
+	feed.set(vevent("practice@example.com", "Practice", "20260605T190000Z"))
+
+	srv := httptest.NewServer(feed)
+	defer srv.Close()
+
+	importRep := &fakeImportRep{}
+	events := newFakeEventStore()
+	s := NewCalendarImportService(importRep, events, NewEventService(events, nil, nil), srv.Client())
+
+	_, err := s.CreateImport(&CreateCalendarImportRequest{GroupID: 7, URL: srv.URL}, ctx)
+	if err != nil {
+		t.Fatalf("CreateImport: %v", err)
+	}
+
+	// Typed here after the import, ending at 22:00.
+	practice := events.byUID("practice@example.com")
+	end := time.Date(2026, 6, 5, 22, 0, 0, 0, time.UTC)
+	practice.Type = "practice"
+	practice.Details = &models.EventDetails{EndTime: &end}
+
+	feed.set(vevent("practice@example.com", "Practice", "20260605T230000Z"))
+
+	s.SyncAll(ctx)
+
+	if importRep.imports[0].LastError != "" {
+		t.Fatalf("sync failed: %s", importRep.imports[0].LastError)
+	}
+
+	practice = events.byUID("practice@example.com")
+	if practice.Type != "practice" || practice.Details != nil {
+		t.Errorf("got type %q with details %+v, want practice without the stale end time", practice.Type, practice.Details)
+	}
+}
+
+func TestCalendarImportSkipsUnreadableEvents(t *testing.T) {
+	ctx := context.Background()
+
+	feed := &feedServer{}
+	feed.set(
+		vevent("social@example.com", "Friday social", "20260605T190000Z"),
+		vevent("class@example.com", "Beginner class", "20260606T180000Z"),
+	)
+
+	srv := httptest.NewServer(feed)
+	defer srv.Close()
+
+	importRep := &fakeImportRep{}
+	events := newFakeEventStore()
+	s := NewCalendarImportService(importRep, events, NewEventService(events, nil, nil), srv.Client())
+
+	_, err := s.CreateImport(&CreateCalendarImportRequest{GroupID: 7, URL: srv.URL}, ctx)
+	if err != nil {
+		t.Fatalf("CreateImport: %v", err)
+	}
+
+	// The class now has a start that can't be read, the social changed.
+	feed.set(
+		vevent("social@example.com", "Friday social, moved", "20260605T200000Z"),
+		vevent("class@example.com", "Beginner class", "not a date"),
+		vevent("workshop@example.com", "Styling workshop", "20260607T120000Z"),
+	)
+
+	s.SyncAll(ctx)
+
+	if !strings.Contains(importRep.imports[0].LastError, "class@example.com") {
+		t.Errorf("got last error %q, want the unreadable class reported", importRep.imports[0].LastError)
+	}
+
+	if class := events.byUID("class@example.com"); class == nil || class.Name != "Beginner class" {
+		t.Errorf("unreadable class wasn't kept as imported before: %+v", class)
+	}
+
+	if social := events.byUID("social@example.com"); social == nil || social.Name != "Friday social, moved" {
+		t.Errorf("social not updated next to the unreadable class: %+v", social)
+	}
+
+	if events.byUID("workshop@example.com") == nil {
+		t.Errorf("workshop not created next to the unreadable class")
+	}
+}
+
+func TestSameImportedEventComparesOverrides(t *testing.T) {
+	recurrenceID := time.Date(2026, 6, 12, 19, 0, 0, 0, time.UTC)
+	moved := recurrenceID.Add(time.Hour)
+	name := "Friday social, live band"
+	renamed := "Friday social, DJ"
+
+	series := func(overrides ...models.OccurrenceOverride) *models.Event {
+		return &models.Event{
+			Name:     "Friday social",
+			Time:     time.Date(2026, 6, 5, 19, 0, 0, 0, time.UTC),
+			Timezone: "UTC",
+			Recurrence: &models.Recurrence{
+				RRule:     "FREQ=WEEKLY",
+				Overrides: overrides,
+			},
+		}
+	}
+
+	stored := series(models.OccurrenceOverride{RecurrenceID: recurrenceID, Name: &name})
+
+	tests := []struct {
+		name string
+		feed *models.Event
+		same bool
+	}{
+		{"unchanged", series(models.OccurrenceOverride{RecurrenceID: recurrenceID, Name: &name}), true},
+		{"renamed", series(models.OccurrenceOverride{RecurrenceID: recurrenceID, Name: &renamed}), false},
+		{"moved", series(models.OccurrenceOverride{RecurrenceID: recurrenceID, Name: &name, Time: &moved}), false},
+		{"other occurrence", series(models.OccurrenceOverride{RecurrenceID: recurrenceID.AddDate(0, 0, 7), Name: &name}), false},
+		{"removed", series(), false},
+	}
+
+	for _, tt := range tests {
+		if got := sameImportedEvent(stored, tt.feed); got != tt.same {
+			t.Errorf("%s: sameImportedEvent = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"slices"
+	"strings"
+)
+
+// defaultLevelScale is the level scale of styles that have none configured,
+// neither themselves nor through a parent.
+var defaultLevelScale = []string{"beginner", "improver", "intermediate", "advanced"}
+
+type danceStyleRep interface {
+	CreateDanceStyle(style *models.DanceStyle, ctx context.Context) (*models.DanceStyle, error)
+	UpdateDanceStyle(id int64, style *models.DanceStyle, ctx context.Context) (*models.DanceStyle, error)
+	DeleteDanceStyle(id int64, ctx context.Context) error
+	GetDanceStyles(ctx context.Context) ([]*models.DanceStyle, error)
+}
+
+// danceStyleLister is the read side of the taxonomy events are normalized
+// and searched with.
+type danceStyleLister interface {
+	GetDanceStyles(ctx context.Context) ([]*models.DanceStyle, error)
+}
+
+type DanceStyleService struct {
+	danceStyleRep danceStyleRep
+}
+
+func NewDanceStyleService(danceStyleRep danceStyleRep) *DanceStyleService {
+	return &DanceStyleService{
+		danceStyleRep: danceStyleRep,
+	}
+}
+
+type CreateDanceStyleRequest struct {
+	Name     string   `json:"name"`
+	ParentID int64    `json:"parentId"`
+	Synonyms []string `json:"synonyms"`
+	// Levels is the style's level scale, lowest first. Without one it
+	// uses its parent's.
+	Levels []string `json:"levels"`
+}
+
+type UpdateDanceStyleRequest struct {
+	Name     string   `json:"name"`
+	ParentID int64    `json:"parentId"`
+	Synonyms []string `json:"synonyms"`
+	// Levels is the style's level scale, lowest first. Without one it
+	// uses its parent's.
+	Levels []string `json:"levels"`
+}
+
+type DanceStyleResponse struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	ParentID int64    `json:"parentId,omitempty"`
+	Synonyms []string `json:"synonyms"`
+	Levels   []string `json:"levels"`
+}
+
+func newDanceStyleResponse(ds *models.DanceStyle) *DanceStyleResponse {
+	synonyms := ds.Synonyms
+	if synonyms == nil {
+		synonyms = []string{}
+	}
+
+	levels := ds.Levels
+	if levels == nil {
+		levels = []string{}
+	}
+
+	return &DanceStyleResponse{
+		ID:       ds.ID,
+		Name:     ds.Name,
+		ParentID: ds.ParentID,
+		Synonyms: synonyms,
+		Levels:   levels,
+	}
+}
+
+func (s *DanceStyleService) CreateDanceStyle(cdsr *CreateDanceStyleRequest, ctx context.Context) (*DanceStyleResponse, error) {
+	style := &models.DanceStyle{
+		Name:     strings.TrimSpace(cdsr.Name),
+		ParentID: cdsr.ParentID,
+		Synonyms: trimAll(cdsr.Synonyms),
+		Levels:   trimAll(cdsr.Levels),
+	}
+
+	err := s.validateDanceStyle(0, style, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	createdStyle, err := s.danceStyleRep.CreateDanceStyle(style, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDanceStyleResponse(createdStyle), nil
+}
+
+// UpdateDanceStyle changes a style in the taxonomy. Events keep the names they
+// were saved with, so a renamed style should list its old name as a synonym.
+func (s *DanceStyleService) UpdateDanceStyle(id int64, udsr *UpdateDanceStyleRequest, ctx context.Context) (*DanceStyleResponse, error) {
+	style := &models.DanceStyle{
+		Name:     strings.TrimSpace(udsr.Name),
+		ParentID: udsr.ParentID,
+		Synonyms: trimAll(udsr.Synonyms),
+		Levels:   trimAll(udsr.Levels),
+	}
+
+	err := s.validateDanceStyle(id, style, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedStyle, err := s.danceStyleRep.UpdateDanceStyle(id, style, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDanceStyleResponse(updatedStyle), nil
+}
+
+// DeleteDanceStyle removes a style without children from the taxonomy.
+func (s *DanceStyleService) DeleteDanceStyle(id int64, ctx context.Context) error {
+	styles, err := s.danceStyleRep.GetDanceStyles(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ds := range styles {
+		if ds.ParentID == id {
+			return fmt.Errorf("dance style %d still has child %q", id, ds.Name)
+		}
+	}
+
+	return s.danceStyleRep.DeleteDanceStyle(id, ctx)
+}
+
+func (s *DanceStyleService) GetDanceStyles(ctx context.Context) ([]*DanceStyleResponse, error) {
+	styles, err := s.danceStyleRep.GetDanceStyles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stylesResp := make([]*DanceStyleResponse, 0, len(styles))
+	for _, ds := range styles {
+		stylesResp = append(stylesResp, newDanceStyleResponse(ds))
+	}
+
+	return stylesResp, nil
+}
+
+// validateDanceStyle checks that style, stored under id or created when id is
+// 0, has a unique name and synonyms, distinct levels and an existing parent
+// that doesn't make the hierarchy circular.
+func (s *DanceStyleService) validateDanceStyle(id int64, style *models.DanceStyle, ctx context.Context) error {
+	if style.Name == "" {
+		return fmt.Errorf("a dance style needs a name")
+	}
+
+	styles, err := s.danceStyleRep.GetDanceStyles(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]*models.DanceStyle, len(styles))
+	taken := make(map[string]string)
+	for _, ds := range styles {
+		byID[ds.ID] = ds
+		if ds.ID == id {
+			continue
+		}
+		for _, name := range append([]string{ds.Name}, ds.Synonyms...) {
+			taken[danceStyleKey(name)] = ds.Name
+		}
+	}
+
+	if id != 0 && byID[id] == nil {
+		return fmt.Errorf("unknown dance style %d", id)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range append([]string{style.Name}, style.Synonyms...) {
+		key := danceStyleKey(name)
+		if other, ok := taken[key]; ok {
+			return fmt.Errorf("%q is already used by dance style %q", name, other)
+		}
+		if seen[key] {
+			return fmt.Errorf("%q is listed twice", name)
+		}
+		seen[key] = true
+	}
+
+	levels := make(map[string]bool)
+	for _, level := range style.Levels {
+		key := danceStyleKey(level)
+		if levels[key] {
+			return fmt.Errorf("level %q is listed twice", level)
+		}
+		levels[key] = true
+	}
+
+	for parentID := style.ParentID; parentID != 0; parentID = byID[parentID].ParentID {
+		if parentID == id {
+			return fmt.Errorf("dance style %q can't be its own ancestor", style.Name)
+		}
+		if byID[parentID] == nil {
+			return fmt.Errorf("unknown parent dance style %d", parentID)
+		}
+	}
+
+	return nil
+}
+
+// danceStyleKey is what names and synonyms are matched by, ignoring case and
+// spacing.
+func danceStyleKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func trimAll(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
+
+// danceStyleTaxonomy looks styles up by name or synonym and walks the
+// hierarchy.
+type danceStyleTaxonomy struct {
+	byID     map[int64]*models.DanceStyle
+	byKey    map[string]*models.DanceStyle
+	children map[int64][]*models.DanceStyle
+}
+
+func newDanceStyleTaxonomy(styles []*models.DanceStyle) *danceStyleTaxonomy {
+	t := &danceStyleTaxonomy{
+		byID:     make(map[int64]*models.DanceStyle),
+		byKey:    make(map[string]*models.DanceStyle),
+		children: make(map[int64][]*models.DanceStyle),
+	}
+
+	for _, ds := range styles {
+		t.byID[ds.ID] = ds
+		for _, name := range append([]string{ds.Name}, ds.Synonyms...) {
+			t.byKey[danceStyleKey(name)] = ds
+		}
+		if ds.ParentID != 0 {
+			t.children[ds.ParentID] = append(t.children[ds.ParentID], ds)
+		}
+	}
+
+	return t
+}
+
+// normalize replaces names and synonyms of known styles by their canonical
+// name and drops duplicates. Unknown styles are kept as they are, so events
+// imported from external calendars don't lose their categories.
+func (t *danceStyleTaxonomy) normalize(styles []string) []string {
+	if styles == nil {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(styles))
+	seen := make(map[string]bool)
+	for _, style := range styles {
+		style = strings.TrimSpace(style)
+		if style == "" {
+			continue
+		}
+
+		if ds, ok := t.byKey[danceStyleKey(style)]; ok {
+			style = ds.Name
+		}
+
+		if !seen[style] {
+			seen[style] = true
+			normalized = append(normalized, style)
+		}
+	}
+
+	return normalized
+}
+
+// withDescendants normalizes styles and adds all their sub-styles, so that
+// searching for a style finds its variants too.
+func (t *danceStyleTaxonomy) withDescendants(styles []string) []string {
+	expanded := t.normalize(styles)
+
+	var addChildren func(id int64)
+	addChildren = func(id int64) {
+		for _, child := range t.children[id] {
+			expanded = append(expanded, child.Name)
+			addChildren(child.ID)
+		}
+	}
+
+	for _, style := range expanded {
+		if ds, ok := t.byKey[danceStyleKey(style)]; ok {
+			addChildren(ds.ID)
+		}
+	}
+
+	return expanded
+}
+
+// levelScale is the level scale of the first of the normalized styles that
+// has one, configured on it or a parent.
+func (t *danceStyleTaxonomy) levelScale(styles []string) []string {
+	for _, style := range styles {
+		for ds := t.byKey[danceStyleKey(style)]; ds != nil; ds = t.byID[ds.ParentID] {
+			if len(ds.Levels) > 0 {
+				return ds.Levels
+			}
+		}
+	}
+
+	return defaultLevelScale
+}
+
+// levelRank is the position of level on scale counting from 1, ignoring case
+// and spacing, or 0 when it isn't on it.
+func levelRank(scale []string, level string) int {
+	key := danceStyleKey(level)
+	return slices.IndexFunc(scale, func(l string) bool { return danceStyleKey(l) == key }) + 1
+}
+
+// rankLevels checks levels against the level scale of the normalized styles.
+// It returns them spelled and ordered like the scale, along with the ranks of
+// the lowest and highest.
+func (t *danceStyleTaxonomy) rankLevels(styles, levels []string) ([]string, int, int, error) {
+	if levels == nil {
+		return nil, 0, 0, nil
+	}
+
+	scale := t.levelScale(styles)
+
+	var ranks []int
+	for _, level := range trimAll(levels) {
+		rank := levelRank(scale, level)
+		if rank == 0 {
+			return nil, 0, 0, models.Invalidf("unknown level %q, levels are %s", level, strings.Join(scale, ", "))
+		}
+		if !slices.Contains(ranks, rank) {
+			ranks = append(ranks, rank)
+		}
+	}
+
+	slices.Sort(ranks)
+
+	ranked := make([]string, 0, len(ranks))
+	for _, rank := range ranks {
+		ranked = append(ranked, scale[rank-1])
+	}
+
+	if len(ranks) == 0 {
+		return ranked, 0, 0, nil
+	}
+
+	return ranked, ranks[0], ranks[len(ranks)-1], nil
+}
+
+// knownLevels drops the levels that aren't on the level scale of the
+// normalized styles, it returns nil when none are.
+func (t *danceStyleTaxonomy) knownLevels(styles, levels []string) []string {
+	scale := t.levelScale(styles)
+
+	var known []string
+	for _, level := range trimAll(levels) {
+		if levelRank(scale, level) > 0 {
+			known = append(known, level)
+		}
+	}
+
+	return known
+}
+
+// levelRange resolves the level names bounding a search to ranks on the
+// level scale of the normalized styles, an empty name leaves that end open.
+func (t *danceStyleTaxonomy) levelRange(styles []string, minLevel, maxLevel string) (int, int, error) {
+	scale := t.levelScale(styles)
+
+	bounds := []struct {
+		level string
+		rank  int
+	}{{strings.TrimSpace(minLevel), 0}, {strings.TrimSpace(maxLevel), 0}}
+
+	for i, b := range bounds {
+		if b.level == "" {
+			continue
+		}
+
+		bounds[i].rank = levelRank(scale, b.level)
+		if bounds[i].rank == 0 {
+			return 0, 0, models.Invalidf("unknown level %q, levels are %s", b.level, strings.Join(scale, ", "))
+		}
+	}
+
+	if bounds[0].rank > 0 && bounds[1].rank > 0 && bounds[0].rank > bounds[1].rank {
+		return 0, 0, models.Invalidf("min level %q is above max level %q", minLevel, maxLevel)
+	}
+
+	return bounds[0].rank, bounds[1].rank, nil
+}
+
+// UseDanceStyles normalizes the dance styles of events against the taxonomy
+// in styles, and expands searched styles to their sub-styles.
+func (e *EventService) UseDanceStyles(styles danceStyleLister) {
+	e.danceStyles = styles
+}
+
+func (e *EventService) danceStyleTaxonomy(ctx context.Context) (*danceStyleTaxonomy, error) {
+	if e.danceStyles == nil {
+		return newDanceStyleTaxonomy(nil), nil
+	}
+
+	styles, err := e.danceStyles.GetDanceStyles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDanceStyleTaxonomy(styles), nil
+}
+
+// NormalizeDanceStyles maps styles to their canonical names in the taxonomy.
+func (e *EventService) NormalizeDanceStyles(styles []string, ctx context.Context) ([]string, error) {
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return taxonomy.normalize(styles), nil
+}
+
+// NormalizeLevels brings the levels of every event in line with the level
+// scale of its styles, for events saved before levels were checked. Levels
+// are spelled and ordered like the scale and those not on it are dropped.
+// It returns the number of events changed.
+func (e *EventService) NormalizeLevels(ctx context.Context) (int, error) {
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := e.eventRep.GetAllEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, event := range events {
+		if event.Levels == nil {
+			continue
+		}
+
+		styles := taxonomy.normalize(event.DanceStyles)
+
+		levels, minLevel, maxLevel, err := taxonomy.rankLevels(styles, taxonomy.knownLevels(styles, event.Levels))
+		if err != nil {
+			return changed, err
+		}
+
+		if slices.Equal(levels, event.Levels) && minLevel == event.MinLevel && maxLevel == event.MaxLevel {
+			continue
+		}
+
+		event.Levels, event.MinLevel, event.MaxLevel = levels, minLevel, maxLevel
+
+		_, err = e.eventRep.UpdateEvent(event.ID, event, ctx)
+		if err != nil {
+			return changed, fmt.Errorf("error normalizing levels of event %d: %v", event.ID, err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
@@ -2,115 +2,385 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github/eventApp/internal/models"
-	"log"
+	"slices"
 	"time"
 )
 
 type eventRep interface {
 	CreateEvent(event *models.Event, ctx context.Context) (*models.Event, error)
 	UpdateEvent(id int64, event *models.Event, ctx context.Context) (*models.Event, error)
+	GetEvent(id int64, ctx context.Context) (*models.Event, error)
 	GetEvents(groupID int64, ctx context.Context) ([]*models.Event, error)
+	GetEventsForUser(userID int64, ctx context.Context) ([]*models.Event, error)
+	GetAllEvents(ctx context.Context) ([]*models.Event, error)
+	DeleteEvent(id int64, ctx context.Context) error
+	SetCancelled(id int64, cancelled bool, ctx context.Context) (*models.Event, error)
 }
 
 type eventSearchRep interface {
-	GetEvents(lat, long, distance float64, ctx context.Context) ([]*models.Event, error)
+	GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error)
+	GetEventClusters(filter *models.EventSearchFilter, precision int, ctx context.Context) ([]*models.EventCluster, error)
+	GetSuggestions(prefix string, size int, ctx context.Context) (*models.EventSuggestions, error)
+	GetEventStats(filter *models.EventSearchFilter, interval string, ctx context.Context) (*models.EventStats, error)
+	GetSimilarEvents(event *models.Event, size int, ctx context.Context) ([]*models.Event, error)
 	IndexEvent(event *models.Event, ctx context.Context) error
+	RemoveEvent(id int64, ctx context.Context) error
+	PruneEvent(id int64, current []*models.Event, ctx context.Context) error
+	Deduplicate(ctx context.Context) (int, error)
+}
+
+type eventRSVPRep interface {
+	GetRSVPCounts(eventIDs []int64, ctx context.Context) (map[models.OccurrenceKey]*models.RSVPCounts, error)
+}
+
+type eventSearchFallbackRep interface {
+	GetEventsNear(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error)
+	GetSuggestions(prefix string, size int, ctx context.Context) (*models.EventSuggestions, error)
 }
 
 type EventService struct {
 	eventRep      eventRep
 	eventSearcher eventSearchRep
+	eventRSVPRep  eventRSVPRep
+
+	searchFallback eventSearchFallbackRep
+	searchBreaker  *circuitBreaker
+	searchTimeout  time.Duration
+
+	regions     regionRep
+	danceStyles danceStyleLister
 }
 
-func NewEventService(eventRep eventRep, eventSearchRep eventSearchRep) *EventService {
+func NewEventService(eventRep eventRep, eventSearchRep eventSearchRep, eventRSVPRep eventRSVPRep) *EventService {
 	return &EventService{
-		eventRep,
-		eventSearchRep,
+		eventRep:      eventRep,
+		eventSearcher: eventSearchRep,
+		eventRSVPRep:  eventRSVPRep,
 	}
 }
 
+// UseSearchFallback answers distance searches from fallback once the search
+// backend failed threshold times in a row or took longer than timeout, and
+// tries the search backend again every cooldown until it recovers.
+func (e *EventService) UseSearchFallback(fallback eventSearchFallbackRep, threshold int, cooldown, timeout time.Duration) {
+	e.searchFallback = fallback
+	e.searchBreaker = newCircuitBreaker(threshold, cooldown)
+	e.searchTimeout = timeout
+}
+
 type CreateEventRequest struct {
-	Name        string    `json:"name"`
-	GroupID     int64     `json:"groupId"`
-	Time        time.Time `json:"time"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	Name             string        `json:"name"`
+	GroupID          int64         `json:"groupId"`
+	Time             time.Time     `json:"time"`
+	Latitude         float64       `json:"latitude"`
+	Longitude        float64       `json:"longitude"`
+	Location         string        `json:"location"`
+	DanceStyles      []string      `json:"danceStyles"`
+	Type             string        `json:"type"`
+	Levels           []string      `json:"levels"`
+	Details          *EventDetails `json:"details,omitempty"`
+	Capacity         int           `json:"capacity"`
+	MaxRoleImbalance int           `json:"maxRoleImbalance"`
+	Timezone         string        `json:"timezone"`
+	Recurrence       *Recurrence   `json:"recurrence,omitempty"`
+	ImportID         int64         `json:"-"`
+	ExternalUID      string        `json:"-"`
 }
 
 type CreateEventResponse struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	GroupID     int64     `json:"groupId"`
-	Time        time.Time `json:"time"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	ID               int64         `json:"id"`
+	Name             string        `json:"name"`
+	GroupID          int64         `json:"groupId"`
+	Time             time.Time     `json:"time"`
+	Latitude         float64       `json:"latitude"`
+	Longitude        float64       `json:"longitude"`
+	Location         string        `json:"location"`
+	DanceStyles      []string      `json:"danceStyles"`
+	Type             string        `json:"type"`
+	Levels           []string      `json:"levels"`
+	Details          *EventDetails `json:"details,omitempty"`
+	Capacity         int           `json:"capacity"`
+	MaxRoleImbalance int           `json:"maxRoleImbalance"`
+	Timezone         string        `json:"timezone"`
+	Recurrence       *Recurrence   `json:"recurrence,omitempty"`
+	Cancelled        bool          `json:"cancelled"`
 }
 
 func (e *EventService) CreateEvent(cer *CreateEventRequest, ctx context.Context) (*CreateEventResponse, error) {
 
+	if cer.Capacity < 0 {
+		return nil, models.Invalidf("capacity can't be negative")
+	}
+
+	if cer.MaxRoleImbalance < 0 {
+		return nil, models.Invalidf("max role imbalance can't be negative")
+	}
+
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	danceStyles := taxonomy.normalize(cer.DanceStyles)
+
+	levels, minLevel, maxLevel, err := taxonomy.rankLevels(danceStyles, cer.Levels)
+	if err != nil {
+		return nil, err
+	}
+
 	event := &models.Event{
-		Name:        cer.Name,
-		GroupID:     cer.GroupID,
-		Time:        cer.Time,
-		Latitude:    cer.Latitude,
-		Longitude:   cer.Longitude,
-		Location:    cer.Location,
-		DanceStyles: cer.DanceStyles,
-		Type:        cer.Type,
-		Levels:      cer.Levels,
+		Name:             cer.Name,
+		GroupID:          cer.GroupID,
+		Time:             cer.Time,
+		Latitude:         cer.Latitude,
+		Longitude:        cer.Longitude,
+		Location:         cer.Location,
+		DanceStyles:      danceStyles,
+		Type:             cer.Type,
+		Levels:           levels,
+		MinLevel:         minLevel,
+		MaxLevel:         maxLevel,
+		Details:          eventDetailsToModel(cer.Details),
+		Capacity:         cer.Capacity,
+		MaxRoleImbalance: cer.MaxRoleImbalance,
+		Timezone:         cer.Timezone,
+		Recurrence:       recurrenceToModel(cer.Recurrence),
+		ImportID:         cer.ImportID,
+		ExternalUID:      cer.ExternalUID,
 	}
 
-	createdEvent, err := e.eventRep.CreateEvent(event, ctx)
+	err = validateEventKind(event)
 	if err != nil {
 		return nil, err
 	}
 
-	err = e.eventSearcher.IndexEvent(createdEvent, ctx)
+	err = validateRecurrence(event)
 	if err != nil {
-		log.Printf("error adding event to elastic search: %v", err)
+		return nil, err
+	}
+
+	createdEvent, err := e.eventRep.CreateEvent(event, ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	ceResp := &CreateEventResponse{
-		ID:          createdEvent.ID,
-		Name:        createdEvent.Name,
-		GroupID:     createdEvent.GroupID,
-		Time:        createdEvent.Time,
-		Latitude:    createdEvent.Latitude,
-		Longitude:   createdEvent.Longitude,
-		Location:    createdEvent.Location,
-		DanceStyles: createdEvent.DanceStyles,
-		Type:        createdEvent.Type,
-		Levels:      createdEvent.Levels,
+		ID:               createdEvent.ID,
+		Name:             createdEvent.Name,
+		GroupID:          createdEvent.GroupID,
+		Time:             createdEvent.Time,
+		Latitude:         createdEvent.Latitude,
+		Longitude:        createdEvent.Longitude,
+		Location:         createdEvent.Location,
+		DanceStyles:      createdEvent.DanceStyles,
+		Type:             createdEvent.Type,
+		Levels:           createdEvent.Levels,
+		Details:          eventDetailsFromModel(createdEvent.Details),
+		Capacity:         createdEvent.Capacity,
+		MaxRoleImbalance: createdEvent.MaxRoleImbalance,
+		Timezone:         createdEvent.Timezone,
+		Recurrence:       recurrenceFromModel(createdEvent.Recurrence),
+		Cancelled:        createdEvent.Cancelled,
 	}
 
 	return ceResp, nil
 
 }
 
+type RSVPCountsResponse struct {
+	Going        int `json:"going"`
+	Interested   int `json:"interested"`
+	NotGoing     int `json:"notGoing"`
+	Waitlisted   int `json:"waitlisted"`
+	GoingLeads   int `json:"goingLeads"`
+	GoingFollows int `json:"goingFollows"`
+	GoingBoth    int `json:"goingBoth"`
+}
+
 type GetEventResponse struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	GroupID     int64     `json:"groupId"`
-	Time        time.Time `json:"time"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	ID               int64               `json:"id"`
+	Name             string              `json:"name"`
+	GroupID          int64               `json:"groupId"`
+	Time             time.Time           `json:"time"`
+	Latitude         float64             `json:"latitude"`
+	Longitude        float64             `json:"longitude"`
+	Location         string              `json:"location"`
+	DanceStyles      []string            `json:"danceStyles"`
+	Type             string              `json:"type"`
+	Levels           []string            `json:"levels"`
+	Details          *EventDetails       `json:"details,omitempty"`
+	Capacity         int                 `json:"capacity"`
+	MaxRoleImbalance int                 `json:"maxRoleImbalance"`
+	Timezone         string              `json:"timezone"`
+	Recurrence       *Recurrence         `json:"recurrence,omitempty"`
+	Cancelled        bool                `json:"cancelled"`
+	RecurrenceID     *time.Time          `json:"recurrenceId,omitempty"`
+	RSVPCounts       RSVPCountsResponse  `json:"rsvpCounts"`
+	Highlights       map[string][]string `json:"highlights,omitempty"`
+	DistanceKm       *float64            `json:"distanceKm,omitempty"`
+}
+
+func newGetEventResponse(e *models.Event) *GetEventResponse {
+	return &GetEventResponse{
+		ID:               e.ID,
+		Name:             e.Name,
+		GroupID:          e.GroupID,
+		Time:             e.Time,
+		Latitude:         e.Latitude,
+		Longitude:        e.Longitude,
+		Location:         e.Location,
+		DanceStyles:      e.DanceStyles,
+		Type:             e.Type,
+		Levels:           e.Levels,
+		Details:          eventDetailsFromModel(e.Details),
+		Capacity:         e.Capacity,
+		MaxRoleImbalance: e.MaxRoleImbalance,
+		Timezone:         e.Timezone,
+		Recurrence:       recurrenceFromModel(e.Recurrence),
+		RecurrenceID:     e.RecurrenceID,
+		Cancelled:        e.Cancelled,
+	}
+}
+
+func (e *EventService) addRSVPCounts(eventsResp []*GetEventResponse, ctx context.Context) error {
+	eventIDs := make([]int64, 0, len(eventsResp))
+	for _, er := range eventsResp {
+		eventIDs = append(eventIDs, er.ID)
+	}
+
+	counts, err := e.eventRSVPRep.GetRSVPCounts(eventIDs, ctx)
+	if err != nil {
+		return err
+	}
+
+	// Occurrences of recurring events are answered one by one, a series
+	// itself has no answers.
+	for _, er := range eventsResp {
+		key := models.OccurrenceKey{EventID: er.ID}
+		if er.RecurrenceID != nil {
+			key.RecurrenceID = er.RecurrenceID.UTC()
+		}
+
+		c, ok := counts[key]
+		if !ok {
+			continue
+		}
+
+		er.RSVPCounts = RSVPCountsResponse{
+			Going:        c.Going,
+			Interested:   c.Interested,
+			NotGoing:     c.NotGoing,
+			Waitlisted:   c.Waitlisted,
+			GoingLeads:   c.GoingLeads,
+			GoingFollows: c.GoingFollows,
+			GoingBoth:    c.GoingBoth,
+		}
+	}
+
+	return nil
+}
+
+// indexEvent adds or replaces an event in the search index, one document per
+// upcoming occurrence for recurring events.
+func (e *EventService) indexEvent(event *models.Event, ctx context.Context) error {
+	now := time.Now()
+
+	occurrences, err := expandOccurrences(event, now, now.Add(recurrenceHorizon))
+	if err != nil {
+		return err
+	}
+
+	for _, o := range occurrences {
+		err = e.eventSearcher.IndexEvent(o, ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.eventSearcher.PruneEvent(event.ID, occurrences, ctx)
+}
+
+type eventGetter interface {
+	GetEvent(id int64, ctx context.Context) (*models.Event, error)
+}
+
+// eventInGroup loads an event, reporting events of other groups as not found
+// so their IDs can't be probed through a group.
+func eventInGroup(events eventGetter, groupID, eventID int64, ctx context.Context) (*models.Event, error) {
+	event, err := events.GetEvent(eventID, ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("event %d: %w", eventID, models.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if event.GroupID != groupID {
+		return nil, fmt.Errorf("event %d in group %d: %w", eventID, groupID, models.ErrNotFound)
+	}
+
+	return event, nil
+}
+
+// syncSearchIndex brings the search index in line with the event as it is
+// stored in Postgres, removing it if it was deleted.
+func (e *EventService) syncSearchIndex(id int64, ctx context.Context) error {
+	event, err := e.eventRep.GetEvent(id, ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return e.eventSearcher.RemoveEvent(id, ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.indexEvent(event, ctx)
 }
 
-func (e *EventService) GetEvents(groupID int64, ctx context.Context) ([]*GetEventResponse, error) {
-	events, err := e.eventRep.GetEvents(groupID, ctx)
+// DeduplicateSearchIndex cleans up documents left over from before documents
+// were keyed by event ID, then indexes every event again.
+func (e *EventService) DeduplicateSearchIndex(ctx context.Context) (int, error) {
+	removed, err := e.eventSearcher.Deduplicate(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := e.eventRep.GetAllEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		err = e.indexEvent(event, ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return removed, nil
+}
+
+// GetEvents returns the events of a group. Recurring events are expanded into
+// their occurrences between from and to, which default to now and the
+// recurrence horizon.
+func (e *EventService) GetEvents(groupID int64, from, to time.Time, ctx context.Context) ([]*GetEventResponse, error) {
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	if to.IsZero() {
+		to = from.Add(recurrenceHorizon)
+	}
+
+	series, err := e.eventRep.GetEvents(groupID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := expandAll(series, from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -118,111 +388,175 @@ func (e *EventService) GetEvents(groupID int64, ctx context.Context) ([]*GetEven
 	eventsResp := make([]*GetEventResponse, 0, len(events))
 
 	for _, e := range events {
-		eventsResp = append(eventsResp, &GetEventResponse{
-			ID:          e.ID,
-			Name:        e.Name,
-			GroupID:     e.GroupID,
-			Time:        e.Time,
-			Latitude:    e.Latitude,
-			Longitude:   e.Longitude,
-			Location:    e.Location,
-			DanceStyles: e.DanceStyles,
-			Type:        e.Type,
-			Levels:      e.Levels,
-		})
+		eventsResp = append(eventsResp, newGetEventResponse(e))
+	}
+
+	err = e.addRSVPCounts(eventsResp, ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	return eventsResp, nil
 }
 
 type UpdateEventRequest struct {
-	Name        string    `json:"name"`
-	GroupID     int64     `json:"groupId"`
-	Time        time.Time `json:"time"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	Name             string        `json:"name"`
+	GroupID          int64         `json:"groupId"`
+	Time             time.Time     `json:"time"`
+	Latitude         float64       `json:"latitude"`
+	Longitude        float64       `json:"longitude"`
+	Location         string        `json:"location"`
+	DanceStyles      []string      `json:"danceStyles"`
+	Type             string        `json:"type"`
+	Levels           []string      `json:"levels"`
+	Details          *EventDetails `json:"details,omitempty"`
+	Capacity         int           `json:"capacity"`
+	MaxRoleImbalance int           `json:"maxRoleImbalance"`
+	Timezone         string        `json:"timezone"`
+	Recurrence       *Recurrence   `json:"recurrence,omitempty"`
 }
 
 type UpdateEventResponse struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	GroupID     int64     `json:"groupId"`
-	Time        time.Time `json:"time"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location"`
-	DanceStyles []string  `json:"danceStyles"`
-	Type        string    `json:"type"`
-	Levels      []string  `json:"levels"`
+	ID               int64         `json:"id"`
+	Name             string        `json:"name"`
+	GroupID          int64         `json:"groupId"`
+	Time             time.Time     `json:"time"`
+	Latitude         float64       `json:"latitude"`
+	Longitude        float64       `json:"longitude"`
+	Location         string        `json:"location"`
+	DanceStyles      []string      `json:"danceStyles"`
+	Type             string        `json:"type"`
+	Levels           []string      `json:"levels"`
+	Details          *EventDetails `json:"details,omitempty"`
+	Capacity         int           `json:"capacity"`
+	MaxRoleImbalance int           `json:"maxRoleImbalance"`
+	Timezone         string        `json:"timezone"`
+	Recurrence       *Recurrence   `json:"recurrence,omitempty"`
+	Cancelled        bool          `json:"cancelled"`
 }
 
-func (e *EventService) UpdateEvent(id int64, uer *UpdateEventRequest, ctx context.Context) (*UpdateEventResponse, error) {
+// UpdateEvent replaces an event of the group, events can't be moved to
+// another group.
+func (e *EventService) UpdateEvent(groupID, eventID int64, uer *UpdateEventRequest, ctx context.Context) (*UpdateEventResponse, error) {
+
+	if uer.Capacity < 0 {
+		return nil, models.Invalidf("capacity can't be negative")
+	}
+
+	if uer.MaxRoleImbalance < 0 {
+		return nil, models.Invalidf("max role imbalance can't be negative")
+	}
+
+	current, err := eventInGroup(e.eventRep, groupID, eventID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	danceStyles := taxonomy.normalize(uer.DanceStyles)
+
+	levels, minLevel, maxLevel, err := taxonomy.rankLevels(danceStyles, uer.Levels)
+	if err != nil {
+		// Levels saved before they were checked, or on the scale of styles
+		// the event no longer has, don't block edits that leave them as
+		// they are. They are kept as stored, only normalize-levels rewrites
+		// them.
+		if !slices.Equal(uer.Levels, current.Levels) {
+			return nil, err
+		}
+
+		levels, minLevel, maxLevel = current.Levels, current.MinLevel, current.MaxLevel
+	}
 
 	event := &models.Event{
-		Name:        uer.Name,
-		GroupID:     uer.GroupID,
-		Time:        uer.Time,
-		Latitude:    uer.Latitude,
-		Longitude:   uer.Longitude,
-		Location:    uer.Location,
-		DanceStyles: uer.DanceStyles,
-		Type:        uer.Type,
-		Levels:      uer.Levels,
+		Name:             uer.Name,
+		GroupID:          groupID,
+		Time:             uer.Time,
+		Latitude:         uer.Latitude,
+		Longitude:        uer.Longitude,
+		Location:         uer.Location,
+		DanceStyles:      danceStyles,
+		Type:             uer.Type,
+		Levels:           levels,
+		MinLevel:         minLevel,
+		MaxLevel:         maxLevel,
+		Details:          eventDetailsToModel(uer.Details),
+		Capacity:         uer.Capacity,
+		MaxRoleImbalance: uer.MaxRoleImbalance,
+		Timezone:         uer.Timezone,
+		Recurrence:       recurrenceToModel(uer.Recurrence),
 	}
 
-	updatedEvent, err := e.eventRep.UpdateEvent(id, event, ctx)
+	err = validateEventKind(event)
 	if err != nil {
 		return nil, err
 	}
 
-	err = e.eventSearcher.IndexEvent(updatedEvent, ctx)
+	err = validateRecurrence(event)
 	if err != nil {
-		log.Printf("error adding event to elastic search: %v", err)
+		return nil, err
+	}
+
+	updatedEvent, err := e.eventRep.UpdateEvent(eventID, event, ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	ueResp := &UpdateEventResponse{
-		ID:          updatedEvent.ID,
-		Name:        updatedEvent.Name,
-		GroupID:     updatedEvent.GroupID,
-		Time:        updatedEvent.Time,
-		Latitude:    updatedEvent.Latitude,
-		Longitude:   updatedEvent.Longitude,
-		Location:    updatedEvent.Location,
-		DanceStyles: updatedEvent.DanceStyles,
-		Type:        updatedEvent.Type,
-		Levels:      updatedEvent.Levels,
+		ID:               updatedEvent.ID,
+		Name:             updatedEvent.Name,
+		GroupID:          updatedEvent.GroupID,
+		Time:             updatedEvent.Time,
+		Latitude:         updatedEvent.Latitude,
+		Longitude:        updatedEvent.Longitude,
+		Location:         updatedEvent.Location,
+		DanceStyles:      updatedEvent.DanceStyles,
+		Type:             updatedEvent.Type,
+		Levels:           updatedEvent.Levels,
+		Details:          eventDetailsFromModel(updatedEvent.Details),
+		Capacity:         updatedEvent.Capacity,
+		MaxRoleImbalance: updatedEvent.MaxRoleImbalance,
+		Timezone:         updatedEvent.Timezone,
+		Recurrence:       recurrenceFromModel(updatedEvent.Recurrence),
+		Cancelled:        updatedEvent.Cancelled,
 	}
 
 	return ueResp, nil
 
 }
 
-func (e *EventService) GetEventsByDistance(lat, long, distance float64, ctx context.Context) ([]*GetEventResponse, error) {
-	events, err := e.eventSearcher.GetEvents(lat, long, distance, ctx)
+func (e *EventService) DeleteEvent(groupID, eventID int64, ctx context.Context) error {
+	_, err := eventInGroup(e.eventRep, groupID, eventID, ctx)
+	if err != nil {
+		return err
+	}
+
+	return e.eventRep.DeleteEvent(eventID, ctx)
+}
+
+// CancelEvent flags an event as cancelled, or restores it, while keeping it
+// visible.
+func (e *EventService) CancelEvent(groupID, eventID int64, cancelled bool, ctx context.Context) (*GetEventResponse, error) {
+	_, err := eventInGroup(e.eventRep, groupID, eventID, ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	eventsResp := make([]*GetEventResponse, 0, len(events))
+	event, err := e.eventRep.SetCancelled(eventID, cancelled, ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, e := range events {
-		eventsResp = append(eventsResp, &GetEventResponse{
-			ID:          e.ID,
-			Name:        e.Name,
-			GroupID:     e.GroupID,
-			Time:        e.Time,
-			Latitude:    e.Latitude,
-			Longitude:   e.Longitude,
-			Location:    e.Location,
-			DanceStyles: e.DanceStyles,
-			Type:        e.Type,
-			Levels:      e.Levels,
-		})
+	eventResp := newGetEventResponse(event)
+
+	err = e.addRSVPCounts([]*GetEventResponse{eventResp}, ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return eventsResp, nil
+	return eventResp, nil
 }
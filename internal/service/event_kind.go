@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EventDetails are the fields specific to an event's type, see GetEventKinds
+// for which of them each type can and has to have.
+type EventDetails struct {
+	EndTime       *time.Time `json:"endTime,omitempty"`
+	Teachers      []string   `json:"teachers,omitempty"`
+	Prerequisites []string   `json:"prerequisites,omitempty"`
+	DJs           []string   `json:"djs,omitempty"`
+	Artists       []string   `json:"artists,omitempty"`
+	Performers    []string   `json:"performers,omitempty"`
+}
+
+func eventDetailsToModel(d *EventDetails) *models.EventDetails {
+	if d == nil {
+		return nil
+	}
+
+	md := models.EventDetails(*d)
+	return &md
+}
+
+func eventDetailsFromModel(md *models.EventDetails) *EventDetails {
+	if md == nil {
+		return nil
+	}
+
+	d := EventDetails(*md)
+	return &d
+}
+
+// eventKind is one of the event types, with the details its events can have.
+type eventKind struct {
+	name     string
+	fields   []string
+	required []string
+	// maxDuration bounds how long after it starts an event can end, 0 for
+	// no bound.
+	maxDuration time.Duration
+}
+
+var eventKinds = []eventKind{
+	{name: "class", fields: []string{"teachers", "prerequisites"}, required: []string{"teachers"}},
+	{name: "social", fields: []string{"endTime", "djs"}, required: []string{"endTime"}, maxDuration: 24 * time.Hour},
+	{name: "workshop", fields: []string{"endTime", "teachers", "prerequisites"}, required: []string{"teachers"}, maxDuration: 24 * time.Hour},
+	{name: "festival", fields: []string{"endTime", "artists"}, required: []string{"endTime"}, maxDuration: 31 * 24 * time.Hour},
+	{name: "performance", fields: []string{"endTime", "performers"}, required: []string{"performers"}, maxDuration: 24 * time.Hour},
+	{name: "practice", fields: []string{"endTime"}, maxDuration: 24 * time.Hour},
+}
+
+// legacyEventTypes maps free-form types used before types were checked to the
+// event types they stand for.
+var legacyEventTypes = map[string]string{
+	"party":    "social",
+	"lesson":   "class",
+	"course":   "class",
+	"show":     "performance",
+	"practica": "practice",
+	"congress": "festival",
+	"marathon": "festival",
+}
+
+// detailNameFields are the details holding lists of names, which searches
+// can filter by.
+var detailNameFields = []string{"teachers", "prerequisites", "djs", "artists", "performers"}
+
+// setDetailFields lists the details that are set, by their JSON names.
+func setDetailFields(d *models.EventDetails) []string {
+	if d == nil {
+		return nil
+	}
+
+	var fields []string
+	if d.EndTime != nil {
+		fields = append(fields, "endTime")
+	}
+
+	for _, f := range []struct {
+		name  string
+		names []string
+	}{
+		{"teachers", d.Teachers},
+		{"prerequisites", d.Prerequisites},
+		{"djs", d.DJs},
+		{"artists", d.Artists},
+		{"performers", d.Performers},
+	} {
+		if len(f.names) > 0 {
+			fields = append(fields, f.name)
+		}
+	}
+
+	return fields
+}
+
+// validateEventKind normalizes the event's type and checks its details against
+// the kind. Events without a type can't have details.
+func validateEventKind(event *models.Event) error {
+	event.Type = strings.ToLower(strings.TrimSpace(event.Type))
+
+	if event.Details != nil {
+		event.Details.Teachers = trimAll(event.Details.Teachers)
+		event.Details.Prerequisites = trimAll(event.Details.Prerequisites)
+		event.Details.DJs = trimAll(event.Details.DJs)
+		event.Details.Artists = trimAll(event.Details.Artists)
+		event.Details.Performers = trimAll(event.Details.Performers)
+	}
+
+	set := setDetailFields(event.Details)
+	if len(set) == 0 {
+		event.Details = nil
+	}
+
+	if event.Type == "" {
+		if len(set) > 0 {
+			return models.Invalidf("events without a type can't have details")
+		}
+		return nil
+	}
+
+	i := slices.IndexFunc(eventKinds, func(k eventKind) bool { return k.name == event.Type })
+	if i < 0 {
+		names := make([]string, 0, len(eventKinds))
+		for _, k := range eventKinds {
+			names = append(names, k.name)
+		}
+		return models.Invalidf("unknown event type %q, types are %s", event.Type, strings.Join(names, ", "))
+	}
+	kind := eventKinds[i]
+
+	for _, field := range set {
+		if !slices.Contains(kind.fields, field) {
+			return models.Invalidf("%s events can't have %s", kind.name, field)
+		}
+	}
+
+	for _, field := range kind.required {
+		if !slices.Contains(set, field) {
+			return models.Invalidf("%s events need %s", kind.name, field)
+		}
+	}
+
+	if event.Details != nil && event.Details.EndTime != nil {
+		if !event.Details.EndTime.After(event.Time) {
+			return models.Invalidf("end time has to be after the start")
+		}
+
+		if kind.maxDuration > 0 && event.Details.EndTime.Sub(event.Time) > kind.maxDuration {
+			return models.Invalidf("%s events can't be longer than %v", kind.name, kind.maxDuration)
+		}
+	}
+
+	return nil
+}
+
+// fitEventKind makes the event's type and details valid by dropping what
+// doesn't fit instead of failing: unknown types, details the type can't have
+// and end times out of its range. When that leaves details the type requires
+// missing, the type is cleared along with the details.
+func fitEventKind(event *models.Event) {
+	event.Type = strings.ToLower(strings.TrimSpace(event.Type))
+	if t, ok := legacyEventTypes[event.Type]; ok {
+		event.Type = t
+	}
+
+	i := slices.IndexFunc(eventKinds, func(k eventKind) bool { return k.name == event.Type })
+	if i < 0 {
+		event.Type = ""
+		event.Details = nil
+		return
+	}
+	kind := eventKinds[i]
+
+	if d := event.Details; d != nil {
+		if d.EndTime != nil && (!d.EndTime.After(event.Time) ||
+			kind.maxDuration > 0 && d.EndTime.Sub(event.Time) > kind.maxDuration) {
+			d.EndTime = nil
+		}
+
+		for _, f := range []struct {
+			name  string
+			clear func()
+		}{
+			{"endTime", func() { d.EndTime = nil }},
+			{"teachers", func() { d.Teachers = nil }},
+			{"prerequisites", func() { d.Prerequisites = nil }},
+			{"djs", func() { d.DJs = nil }},
+			{"artists", func() { d.Artists = nil }},
+			{"performers", func() { d.Performers = nil }},
+		} {
+			if !slices.Contains(kind.fields, f.name) {
+				f.clear()
+			}
+		}
+	}
+
+	set := setDetailFields(event.Details)
+	if len(set) == 0 {
+		event.Details = nil
+	}
+
+	for _, field := range kind.required {
+		if !slices.Contains(set, field) {
+			event.Type = ""
+			event.Details = nil
+			return
+		}
+	}
+}
+
+// NormalizeEventKinds fits the type and details of every event to the event
+// types, for events saved before types were checked. Legacy types are mapped
+// to the types they stand for and cleared when there is none, see
+// fitEventKind. It returns the number of events changed.
+func (e *EventService) NormalizeEventKinds(ctx context.Context) (int, error) {
+	events, err := e.eventRep.GetAllEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, event := range events {
+		eventType, details := event.Type, eventDetailsToModel(eventDetailsFromModel(event.Details))
+
+		fitEventKind(event)
+
+		if event.Type == eventType && reflect.DeepEqual(event.Details, details) {
+			continue
+		}
+
+		_, err = e.eventRep.UpdateEvent(event.ID, event, ctx)
+		if err != nil {
+			return changed, fmt.Errorf("error normalizing type of event %d: %v", event.ID, err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// validateDetailFilters checks that searches only filter by details holding
+// names.
+func validateDetailFilters(details map[string][]string) error {
+	for field := range details {
+		if !slices.Contains(detailNameFields, field) {
+			return models.Invalidf("can't filter by detail %q, details are %s", field, strings.Join(detailNameFields, ", "))
+		}
+	}
+
+	return nil
+}
+
+type EventKindResponse struct {
+	Name     string   `json:"name"`
+	Fields   []string `json:"fields"`
+	Required []string `json:"required"`
+}
+
+// GetEventKinds lists the event types and the details they can and have to
+// have.
+func (e *EventService) GetEventKinds(ctx context.Context) []*EventKindResponse {
+	kindsResp := make([]*EventKindResponse, 0, len(eventKinds))
+	for _, k := range eventKinds {
+		required := k.required
+		if required == nil {
+			required = []string{}
+		}
+
+		kindsResp = append(kindsResp, &EventKindResponse{
+			Name:     k.name,
+			Fields:   k.fields,
+			Required: required,
+		})
+	}
+
+	return kindsResp
+}
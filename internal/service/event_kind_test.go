@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFitEventKind(t *testing.T) {
+	start := time.Date(2026, 6, 5, 19, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	early := start.Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		event       models.Event
+		wantType    string
+		wantDetails *models.EventDetails
+	}{
+		{
+			name:        "valid",
+			event:       models.Event{Type: "social", Details: &models.EventDetails{EndTime: &end, DJs: []string{"Ella"}}},
+			wantType:    "social",
+			wantDetails: &models.EventDetails{EndTime: &end, DJs: []string{"Ella"}},
+		},
+		{
+			name:        "legacy type",
+			event:       models.Event{Type: " Lesson ", Details: &models.EventDetails{Teachers: []string{"Sam"}}},
+			wantType:    "class",
+			wantDetails: &models.EventDetails{Teachers: []string{"Sam"}},
+		},
+		{
+			name:     "unknown type",
+			event:    models.Event{Type: "jam night", Details: &models.EventDetails{DJs: []string{"Ella"}}},
+			wantType: "",
+		},
+		{
+			name:        "details the type can't have",
+			event:       models.Event{Type: "practice", Details: &models.EventDetails{EndTime: &end, DJs: []string{"Ella"}}},
+			wantType:    "practice",
+			wantDetails: &models.EventDetails{EndTime: &end},
+		},
+		{
+			name:     "end time before the start",
+			event:    models.Event{Type: "practice", Details: &models.EventDetails{EndTime: &early}},
+			wantType: "practice",
+		},
+		{
+			name:     "required detail missing",
+			event:    models.Event{Type: "social", Details: &models.EventDetails{EndTime: &early, DJs: []string{"Ella"}}},
+			wantType: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := tt.event
+			event.Time = start
+
+			fitEventKind(&event)
+
+			if event.Type != tt.wantType || !reflect.DeepEqual(event.Details, tt.wantDetails) {
+				t.Errorf("got type %q with details %+v, want %q with %+v", event.Type, event.Details, tt.wantType, tt.wantDetails)
+			}
+
+			if err := validateEventKind(&event); err != nil {
+				t.Errorf("fitted event isn't valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeEventKinds(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	legacy, _ := events.CreateEvent(&models.Event{Name: "Legacy", Type: "Milonga night"}, ctx)
+	mapped, _ := events.CreateEvent(&models.Event{Name: "Mapped", Type: "Practica"}, ctx)
+	current, _ := events.CreateEvent(&models.Event{Name: "Current", Type: "practice"}, ctx)
+
+	s := NewEventService(events, nil, nil)
+
+	changed, err := s.NormalizeEventKinds(ctx)
+	if err != nil {
+		t.Fatalf("NormalizeEventKinds: %v", err)
+	}
+
+	if changed != 2 {
+		t.Errorf("changed %d events, want 2", changed)
+	}
+
+	for id, want := range map[int64]string{legacy.ID: "", mapped.ID: "practice", current.ID: "practice"} {
+		if got := events.events[id].Type; got != want {
+			t.Errorf("event %q has type %q, want %q", events.events[id].Name, got, want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/eventApp/internal/models"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MapEventsRequest struct {
+	Query            string
+	Top              float64
+	Left             float64
+	Bottom           float64
+	Right            float64
+	Zoom             int
+	IncludeCancelled bool
+	DanceStyles      []string
+	Levels           []string
+	Types            []string
+	From             time.Time
+	To               time.Time
+	MinLevel         string
+	MaxLevel         string
+	Details          map[string][]string
+}
+
+const (
+	// clusterMaxZoom is the zoom level from which individual events are
+	// shown instead of clusters.
+	clusterMaxZoom = 14
+	// clusterPrecision is how many tile levels below the map zoom events
+	// are clustered at, so a cluster covers a fraction of the screen.
+	clusterPrecision = 3
+	maxTileZoom      = 29
+	maxMapEvents     = 500
+	// maxMercatorLatitude is where web mercator tiles end.
+	maxMercatorLatitude = 85.05112878
+)
+
+type EventClusterResponse struct {
+	Key       string  `json:"key"`
+	Count     int     `json:"count"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type MapEventsResponse struct {
+	Zoom     int                    `json:"zoom"`
+	Clusters []EventClusterResponse `json:"clusters,omitempty"`
+	Events   []*GetEventResponse    `json:"events,omitempty"`
+	// FromFallback is set when the search backend was unavailable and the
+	// events came from Postgres.
+	FromFallback bool `json:"-"`
+}
+
+// GetMapEvents finds the events inside a map viewport. Zoomed out they are
+// clustered into tiles with counts and centroids, zoomed in each event is
+// returned once, at its next occurrence.
+func (e *EventService) GetMapEvents(mer *MapEventsRequest, ctx context.Context) (*MapEventsResponse, error) {
+	if mer.Top < mer.Bottom || mer.Top > 90 || mer.Bottom < -90 {
+		return nil, models.Invalidf("invalid viewport latitudes %v and %v", mer.Top, mer.Bottom)
+	}
+
+	if mer.Left < -180 || mer.Left > 180 || mer.Right < -180 || mer.Right > 180 {
+		return nil, models.Invalidf("invalid viewport longitudes %v and %v", mer.Left, mer.Right)
+	}
+
+	if mer.Zoom < 0 || mer.Zoom > maxTileZoom {
+		return nil, models.Invalidf("zoom has to be between 0 and %d", maxTileZoom)
+	}
+
+	if !mer.From.IsZero() && !mer.To.IsZero() && !mer.From.Before(mer.To) {
+		return nil, models.Invalidf("from has to be before to")
+	}
+
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	minLevel, maxLevel, err := taxonomy.levelRange(taxonomy.normalize(mer.DanceStyles), mer.MinLevel, mer.MaxLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateDetailFilters(mer.Details)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.EventSearchFilter{
+		Query: strings.TrimSpace(mer.Query),
+		BoundingBox: &models.BoundingBox{
+			Top:    mer.Top,
+			Left:   mer.Left,
+			Bottom: mer.Bottom,
+			Right:  mer.Right,
+		},
+		IncludeCancelled: mer.IncludeCancelled,
+		DanceStyles:      taxonomy.withDescendants(mer.DanceStyles),
+		Levels:           mer.Levels,
+		MinLevel:         minLevel,
+		MaxLevel:         maxLevel,
+		Details:          mer.Details,
+		Types:            mer.Types,
+		From:             mer.From,
+		To:               mer.To,
+	}
+
+	// Maps show upcoming events, whichever backend answers.
+	if filter.From.IsZero() {
+		filter.From = time.Now()
+	}
+
+	if mer.Zoom >= clusterMaxZoom {
+		return e.getMapEvents(filter, mer.Zoom, ctx)
+	}
+
+	precision := min(mer.Zoom+clusterPrecision, maxTileZoom)
+
+	var clusters []*models.EventCluster
+
+	fromFallback, err := e.withSearchFallback(func(ctx context.Context) error {
+		var err error
+		clusters, err = e.eventSearcher.GetEventClusters(filter, precision, ctx)
+		if !errors.Is(err, models.ErrUnsupported) {
+			return err
+		}
+
+		// Backends without aggregations leave clustering to us.
+		result, err := e.eventSearcher.GetEvents(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		clusters, err = clusterEvents(result.Hits, filter, precision)
+		return err
+	}, func(ctx context.Context) error {
+		result, err := e.searchFallback.GetEventsNear(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		clusters, err = clusterEvents(result.Hits, filter, precision)
+		return err
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mapResp := &MapEventsResponse{
+		Zoom:         mer.Zoom,
+		Clusters:     make([]EventClusterResponse, 0, len(clusters)),
+		FromFallback: fromFallback,
+	}
+
+	for _, c := range clusters {
+		mapResp.Clusters = append(mapResp.Clusters, EventClusterResponse(*c))
+	}
+
+	return mapResp, nil
+}
+
+func (e *EventService) getMapEvents(filter *models.EventSearchFilter, zoom int, ctx context.Context) (*MapEventsResponse, error) {
+	filter.Size = maxMapEvents
+
+	result, fromFallback, err := e.searchDistinctEvents(filter, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mapResp := &MapEventsResponse{
+		Zoom:         zoom,
+		Events:       make([]*GetEventResponse, 0, len(result.Hits)),
+		FromFallback: fromFallback,
+	}
+
+	for _, hit := range result.Hits {
+		mapResp.Events = append(mapResp.Events, newGetEventResponse(hit.Event))
+	}
+
+	err = e.addRSVPCounts(mapResp.Events, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapResp, nil
+}
+
+// searchDistinctEvents searches for events by their next occurrence only, up
+// to the filter size.
+func (e *EventService) searchDistinctEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, bool, error) {
+	filter.Distinct = true
+
+	result, fromFallback, err := e.searchEvents(filter, ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if result.Facets == nil {
+		result, err = filterEvents(result.Hits, filter)
+		if err != nil {
+			return nil, false, err
+		}
+
+		result.Hits = distinctHits(result.Hits)
+		pageEvents(result, filter)
+	}
+
+	return result, fromFallback, nil
+}
+
+// distinctHits keeps the earliest occurrence of each event, like collapsing
+// on the event ID does in the search index.
+func distinctHits(hits []*models.EventSearchHit) []*models.EventSearchHit {
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Event.Time.Before(hits[j].Event.Time)
+	})
+
+	seen := make(map[int64]bool, len(hits))
+	distinct := hits[:0]
+	for _, hit := range hits {
+		if !seen[hit.Event.ID] {
+			seen[hit.Event.ID] = true
+			distinct = append(distinct, hit)
+		}
+	}
+
+	return distinct
+}
+
+// clusterEvents does in memory what the geotile grid aggregation does for
+// backends that return every matching event as a series.
+func clusterEvents(hits []*models.EventSearchHit, filter *models.EventSearchFilter, precision int) ([]*models.EventCluster, error) {
+	result, err := filterEvents(hits, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]*models.EventCluster)
+	for _, hit := range distinctHits(result.Hits) {
+		x, y := tileOf(hit.Event.Latitude, hit.Event.Longitude, precision)
+		key := fmt.Sprintf("%d/%d/%d", precision, x, y)
+
+		c, ok := clusters[key]
+		if !ok {
+			c = &models.EventCluster{Key: key}
+			clusters[key] = c
+		}
+
+		// Running mean of the event locations.
+		c.Count++
+		c.Latitude += (hit.Event.Latitude - c.Latitude) / float64(c.Count)
+		c.Longitude += (hit.Event.Longitude - c.Longitude) / float64(c.Count)
+	}
+
+	sorted := make([]*models.EventCluster, 0, len(clusters))
+	for _, c := range clusters {
+		sorted = append(sorted, c)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	return sorted, nil
+}
+
+// tileOf returns the web mercator tile containing a location at a zoom level.
+func tileOf(lat, long float64, zoom int) (int, int) {
+	fx, fy := tileFraction(lat, long, zoom)
+	n := 1 << zoom
+
+	clamp := func(v int) int {
+		return max(0, min(v, n-1))
+	}
+
+	return clamp(int(math.Floor(fx))), clamp(int(math.Floor(fy)))
+}
+
+// tileFraction returns a location in tile coordinates at a zoom level, the
+// integer part being the tile and the fraction the position inside it.
+func tileFraction(lat, long float64, zoom int) (float64, float64) {
+	n := math.Exp2(float64(zoom))
+	// The projection doesn't reach the poles.
+	latRad := max(-maxMercatorLatitude, min(lat, maxMercatorLatitude)) * math.Pi / 180
+
+	x := (long + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+
+	return x, y
+}
+
+// tileBounds returns the bounding box of a web mercator tile.
+func tileBounds(x, y, zoom int) *models.BoundingBox {
+	n := math.Exp2(float64(zoom))
+
+	long := func(x int) float64 {
+		return float64(x)/n*360 - 180
+	}
+	lat := func(y int) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	}
+
+	return &models.BoundingBox{
+		Top:    lat(y),
+		Left:   long(x),
+		Bottom: lat(y + 1),
+		Right:  long(x + 1),
+	}
+}
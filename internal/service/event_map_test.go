@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+func TestClusterEvents(t *testing.T) {
+	start := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Hour)
+
+	hits := []*models.EventSearchHit{
+		{Event: &models.Event{ID: 1, Time: start, Latitude: 52.50, Longitude: 13.40}},
+		{Event: &models.Event{ID: 2, Time: start, Latitude: 52.54, Longitude: 13.44, Type: "class"}},
+		// Weekly, it's counted once however many occurrences match.
+		{Event: &models.Event{
+			ID:         3,
+			Time:       start,
+			Latitude:   52.52,
+			Longitude:  13.42,
+			Timezone:   "Europe/Berlin",
+			Recurrence: &models.Recurrence{RRule: "FREQ=WEEKLY;COUNT=10"},
+		}},
+		{Event: &models.Event{ID: 4, Time: start, Latitude: 48.14, Longitude: 11.58}},
+	}
+
+	clusters, err := clusterEvents(hits, &models.EventSearchFilter{}, 6)
+	if err != nil {
+		t.Fatalf("clusterEvents: %v", err)
+	}
+
+	if len(clusters) != 2 {
+		t.Fatalf("got %d clusters, want Berlin and Munich", len(clusters))
+	}
+
+	berlin, munich := clusters[0], clusters[1]
+
+	if berlin.Count != 3 || munich.Count != 1 {
+		t.Errorf("got counts %d and %d, want 3 and 1 ordered by count", berlin.Count, munich.Count)
+	}
+
+	x, y := tileOf(52.52, 13.42, 6)
+	if berlin.Key != fmt.Sprintf("6/%d/%d", x, y) {
+		t.Errorf("got key %q for the Berlin cluster, want its tile at precision 6", berlin.Key)
+	}
+
+	// The mean of the events in the cluster.
+	if !near(berlin.Latitude, 52.52) || !near(berlin.Longitude, 13.42) {
+		t.Errorf("got Berlin cluster at %f, %f, want 52.52, 13.42", berlin.Latitude, berlin.Longitude)
+	}
+
+	clusters, err = clusterEvents(hits, &models.EventSearchFilter{Types: []string{"class"}}, 6)
+	if err != nil {
+		t.Fatalf("clusterEvents with a type: %v", err)
+	}
+
+	if len(clusters) != 1 || clusters[0].Count != 1 || !near(clusters[0].Latitude, 52.54) {
+		t.Errorf("got clusters %+v, want the Berlin class only", clusters)
+	}
+}
+
+func TestTileBoundsContainTheirTile(t *testing.T) {
+	for _, tile := range [][3]int{{0, 0, 0}, {1, 2, 2}, {550, 335, 10}} {
+		x, y, zoom := tile[0], tile[1], tile[2]
+		bounds := tileBounds(x, y, zoom)
+
+		lat, long := (bounds.Top+bounds.Bottom)/2, (bounds.Left+bounds.Right)/2
+		if gotX, gotY := tileOf(lat, long, zoom); gotX != x || gotY != y {
+			t.Errorf("center of tile %d/%d/%d is in tile %d/%d", zoom, x, y, gotX, gotY)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+// recordingSearcher answers every search with no events and keeps the
+// filters it was asked with.
+type recordingSearcher struct {
+	eventSearchRep
+	filters []models.EventSearchFilter
+}
+
+func (s *recordingSearcher) GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	s.filters = append(s.filters, *filter)
+	return &models.EventSearchResult{Facets: &models.EventFacets{}}, nil
+}
+
+func (s *recordingSearcher) GetEventClusters(filter *models.EventSearchFilter, precision int, ctx context.Context) ([]*models.EventCluster, error) {
+	s.filters = append(s.filters, *filter)
+	return nil, nil
+}
+
+// noRSVPs has no answers for any event.
+type noRSVPs struct{}
+
+func (noRSVPs) GetRSVPCounts(eventIDs []int64, ctx context.Context) (map[models.OccurrenceKey]*models.RSVPCounts, error) {
+	return nil, nil
+}
+
+func TestMapSearchesStartNow(t *testing.T) {
+	ctx := context.Background()
+
+	searcher := &recordingSearcher{}
+	s := NewEventService(nil, searcher, noRSVPs{})
+
+	before := time.Now()
+
+	for _, zoom := range []int{3, clusterMaxZoom} {
+		_, err := s.GetMapEvents(&MapEventsRequest{Top: 60, Left: 0, Bottom: 40, Right: 20, Zoom: zoom}, ctx)
+		if err != nil {
+			t.Fatalf("GetMapEvents at zoom %d: %v", zoom, err)
+		}
+	}
+
+	_, err := s.EventTile(&EventTileRequest{Z: 1, X: 1, Y: 0}, ctx)
+	if err != nil {
+		t.Fatalf("EventTile: %v", err)
+	}
+
+	if len(searcher.filters) != 3 {
+		t.Fatalf("got %d searches, want 3", len(searcher.filters))
+	}
+
+	for i, filter := range searcher.filters {
+		if filter.From.Before(before) || filter.From.After(time.Now()) {
+			t.Errorf("search %d from %v, want now", i, filter.From)
+		}
+	}
+}
+
+func TestGetMapEventsRejectsInvalidViewports(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		mer  MapEventsRequest
+	}{
+		{"top below bottom", MapEventsRequest{Top: 40, Bottom: 60}},
+		{"latitude out of range", MapEventsRequest{Top: 91, Bottom: 0}},
+		{"longitude out of range", MapEventsRequest{Top: 60, Bottom: 40, Left: -181}},
+		{"zoom out of range", MapEventsRequest{Top: 60, Bottom: 40, Zoom: maxTileZoom + 1}},
+		{"from after to", MapEventsRequest{Top: 60, Bottom: 40, From: now, To: now.Add(-time.Hour)}},
+	}
+
+	s := NewEventService(nil, &recordingSearcher{}, noRSVPs{})
+
+	for _, tt := range tests {
+		_, err := s.GetMapEvents(&tt.mer, context.Background())
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: got %v, want a validation error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github/eventApp/internal/models"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SearchEventsRequest struct {
+	Query            string
+	Latitude         float64
+	Longitude        float64
+	Distance         float64
+	IncludeCancelled bool
+	DanceStyles      []string
+	Levels           []string
+	Types            []string
+	From             time.Time
+	To               time.Time
+	Size             int
+	Cursor           string
+	// Region is the name of a loaded region and Polygon a drawn area as
+	// latitude, longitude pairs, either limits the search to the events
+	// inside it.
+	Region  string
+	Polygon [][2]float64
+	// MinLevel and MaxLevel are names on the level scale of the searched
+	// dance style and limit the search to events overlapping the range.
+	MinLevel string
+	MaxLevel string
+	// Details maps detail fields holding names, like teachers, to the
+	// names to look for.
+	Details map[string][]string
+}
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+type FacetCountResponse struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type EventFacetsResponse struct {
+	DanceStyles []FacetCountResponse `json:"danceStyles"`
+	Levels      []FacetCountResponse `json:"levels"`
+	Types       []FacetCountResponse `json:"types"`
+}
+
+type SearchEventsResponse struct {
+	Total  int                 `json:"total"`
+	Events []*GetEventResponse `json:"events"`
+	Facets EventFacetsResponse `json:"facets"`
+	// NextCursor fetches the next page, it's empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+	// FromFallback is set when the search backend was unavailable and the
+	// events came from Postgres.
+	FromFallback bool `json:"-"`
+}
+
+// SearchEvents finds events matching a text query, near a location or both,
+// narrowed down by dance style, level, type and time, along with facet counts
+// for each dimension.
+func (e *EventService) SearchEvents(ser *SearchEventsRequest, ctx context.Context) (*SearchEventsResponse, error) {
+	if strings.TrimSpace(ser.Query) == "" && ser.Distance <= 0 && ser.Region == "" && len(ser.Polygon) == 0 {
+		return nil, models.Invalidf("a text query, a distance or an area is required")
+	}
+
+	if !ser.From.IsZero() && !ser.To.IsZero() && !ser.From.Before(ser.To) {
+		return nil, models.Invalidf("from has to be before to")
+	}
+
+	size := ser.Size
+	if size == 0 {
+		size = defaultSearchPageSize
+	}
+	if size < 0 || size > maxSearchPageSize {
+		return nil, models.Invalidf("size has to be between 1 and %d", maxSearchPageSize)
+	}
+
+	after, err := decodeCursor(ser.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := e.newSearchFilter(ser, ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter.Size = size
+	filter.After = after
+
+	result, fromFallback, err := e.searchEvents(filter, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Facets == nil {
+		result, err = filterEvents(result.Hits, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		pageEvents(result, filter)
+	}
+
+	searchResp := &SearchEventsResponse{
+		Total:  result.Total,
+		Events: make([]*GetEventResponse, 0, len(result.Hits)),
+		Facets: EventFacetsResponse{
+			DanceStyles: newFacetCountsResponse(result.Facets.DanceStyles),
+			Levels:      newFacetCountsResponse(result.Facets.Levels),
+			Types:       newFacetCountsResponse(result.Facets.Types),
+		},
+		FromFallback: fromFallback,
+	}
+
+	for _, hit := range result.Hits {
+		eventResp := newGetEventResponse(hit.Event)
+		eventResp.Highlights = hit.Highlights
+		if filter.Distance > 0 {
+			d := distanceKm(filter.Latitude, filter.Longitude, hit.Event.Latitude, hit.Event.Longitude)
+			eventResp.DistanceKm = &d
+		}
+		searchResp.Events = append(searchResp.Events, eventResp)
+	}
+
+	if len(result.Hits) == size {
+		searchResp.NextCursor, err = encodeCursor(result.Hits[size-1].Sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = e.addRSVPCounts(searchResp.Events, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchResp, nil
+}
+
+// newSearchFilter builds the filter shared by the event search endpoints.
+func (e *EventService) newSearchFilter(ser *SearchEventsRequest, ctx context.Context) (*models.EventSearchFilter, error) {
+	area, err := e.searchArea(ser.Region, ser.Polygon, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Searching for a style finds events of its sub-styles too.
+	taxonomy, err := e.danceStyleTaxonomy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	minLevel, maxLevel, err := taxonomy.levelRange(taxonomy.normalize(ser.DanceStyles), ser.MinLevel, ser.MaxLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateDetailFilters(ser.Details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.EventSearchFilter{
+		Query:            strings.TrimSpace(ser.Query),
+		Latitude:         ser.Latitude,
+		Longitude:        ser.Longitude,
+		Distance:         ser.Distance,
+		IncludeCancelled: ser.IncludeCancelled,
+		DanceStyles:      taxonomy.withDescendants(ser.DanceStyles),
+		Levels:           ser.Levels,
+		MinLevel:         minLevel,
+		MaxLevel:         maxLevel,
+		Details:          ser.Details,
+		Types:            ser.Types,
+		From:             ser.From,
+		To:               ser.To,
+		Area:             area,
+	}, nil
+}
+
+// searchEvents reports whether the result came from the fallback.
+func (e *EventService) searchEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, bool, error) {
+	var result *models.EventSearchResult
+
+	fromFallback, err := e.withSearchFallback(func(ctx context.Context) error {
+		var err error
+		result, err = e.eventSearcher.GetEvents(filter, ctx)
+		return err
+	}, func(ctx context.Context) error {
+		var err error
+		result, err = e.searchFallback.GetEventsNear(filter, ctx)
+		return err
+	}, ctx)
+
+	return result, fromFallback, err
+}
+
+// withSearchFallback runs search behind the circuit breaker and runs fallback
+// instead when the search backend fails or the breaker is open. It reports
+// whether the fallback was used. Searches the backend refused as invalid are
+// returned as they are, the backend answered and the fallback would refuse
+// them too.
+func (e *EventService) withSearchFallback(search, fallback func(ctx context.Context) error, ctx context.Context) (bool, error) {
+	if e.searchBreaker == nil {
+		return false, search(ctx)
+	}
+
+	if e.searchBreaker.allow() {
+		searchCtx, cancel := context.WithTimeout(ctx, e.searchTimeout)
+		err := search(searchCtx)
+		cancel()
+
+		var invalid *models.ValidationError
+		if err == nil || errors.As(err, &invalid) {
+			e.searchBreaker.success()
+			return false, err
+		}
+
+		e.searchBreaker.failure()
+		log.Printf("error searching elastic search, falling back to postgres: %v", err)
+	}
+
+	return true, fallback(ctx)
+}
+
+func newFacetCountsResponse(counts []models.FacetCount) []FacetCountResponse {
+	countsResp := make([]FacetCountResponse, 0, len(counts))
+	for _, c := range counts {
+		countsResp = append(countsResp, FacetCountResponse(c))
+	}
+	return countsResp
+}
+
+// filterEvents does in memory what the search index does for backends that
+// return every matching event as a series: it expands recurring events like
+// the indexer would, then applies the time and facet filters and counts the
+// facets.
+func filterEvents(hits []*models.EventSearchHit, filter *models.EventSearchFilter) (*models.EventSearchResult, error) {
+	series := make([]*models.Event, 0, len(hits))
+	for _, hit := range hits {
+		series = append(series, hit.Event)
+	}
+
+	from, to := filter.From, filter.To
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() {
+		to = from.Add(recurrenceHorizon)
+	}
+
+	events, err := expandAll(series, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	dimensions := []struct {
+		filter []string
+		values func(*models.Event) []string
+		counts map[string]int
+	}{
+		{filter.DanceStyles, func(e *models.Event) []string { return e.DanceStyles }, make(map[string]int)},
+		{filter.Levels, func(e *models.Event) []string { return e.Levels }, make(map[string]int)},
+		{filter.Types, func(e *models.Event) []string { return []string{e.Type} }, make(map[string]int)},
+	}
+
+	result := &models.EventSearchResult{Hits: make([]*models.EventSearchHit, 0, len(events))}
+
+	for _, event := range events {
+		if !filter.From.IsZero() && event.Time.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !event.Time.Before(filter.To) {
+			continue
+		}
+
+		mismatches := 0
+		mismatched := -1
+		for i, d := range dimensions {
+			if len(d.filter) > 0 && !slices.ContainsFunc(d.values(event), func(v string) bool { return slices.Contains(d.filter, v) }) {
+				mismatches++
+				mismatched = i
+			}
+		}
+
+		if mismatches == 0 {
+			result.Hits = append(result.Hits, &models.EventSearchHit{Event: event})
+		}
+
+		// An event counts towards a facet if it matches the filters of all
+		// other dimensions.
+		for i, d := range dimensions {
+			if mismatches == 0 || (mismatches == 1 && mismatched == i) {
+				for _, v := range d.values(event) {
+					if v != "" {
+						d.counts[v]++
+					}
+				}
+			}
+		}
+	}
+
+	result.Facets = &models.EventFacets{
+		DanceStyles: sortedFacetCounts(dimensions[0].counts),
+		Levels:      sortedFacetCounts(dimensions[1].counts),
+		Types:       sortedFacetCounts(dimensions[2].counts),
+	}
+
+	return result, nil
+}
+
+// sortedFacetCounts orders counts like Elasticsearch terms aggregations, by
+// count and then by value.
+func sortedFacetCounts(counts map[string]int) []models.FacetCount {
+	facetCounts := make([]models.FacetCount, 0, len(counts))
+	for v, c := range counts {
+		facetCounts = append(facetCounts, models.FacetCount{Value: v, Count: c})
+	}
+
+	sort.Slice(facetCounts, func(i, j int) bool {
+		if facetCounts[i].Count != facetCounts[j].Count {
+			return facetCounts[i].Count > facetCounts[j].Count
+		}
+		return facetCounts[i].Value < facetCounts[j].Value
+	})
+
+	return facetCounts
+}
+
+// pageEvents sorts and pages the result of filterEvents like the search index
+// does, by distance when searching near a location, then by time and ID.
+func pageEvents(result *models.EventSearchResult, filter *models.EventSearchFilter) {
+	for _, hit := range result.Hits {
+		var sortValues []any
+		if filter.Distance > 0 {
+			sortValues = append(sortValues, distanceKm(filter.Latitude, filter.Longitude, hit.Event.Latitude, hit.Event.Longitude))
+		}
+		hit.Sort = append(sortValues, float64(hit.Event.Time.UnixMilli()), float64(hit.Event.ID))
+	}
+
+	sort.SliceStable(result.Hits, func(i, j int) bool {
+		return compareSortValues(result.Hits[i].Sort, result.Hits[j].Sort) < 0
+	})
+
+	result.Total = len(result.Hits)
+
+	if len(filter.After) > 0 {
+		start := sort.Search(len(result.Hits), func(i int) bool {
+			return compareSortValues(result.Hits[i].Sort, filter.After) > 0
+		})
+		result.Hits = result.Hits[start:]
+	}
+
+	if len(result.Hits) > filter.Size {
+		result.Hits = result.Hits[:filter.Size]
+	}
+}
+
+func compareSortValues(a, b []any) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := sortValueFloat(a[i]), sortValueFloat(b[i])
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func sortValueFloat(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	}
+	return 0
+}
+
+// encodeCursor turns the sort values of the last event of a page into an
+// opaque cursor for the next page.
+func encodeCursor(sortValues []any) (string, error) {
+	if len(sortValues) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string) ([]any, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, models.Invalidf("invalid cursor: %v", err)
+	}
+
+	// Numbers are kept as they are, large sort values like timestamps must
+	// reach the search index unchanged.
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var sortValues []any
+	err = decoder.Decode(&sortValues)
+	if err != nil {
+		return nil, models.Invalidf("invalid cursor: %v", err)
+	}
+
+	return sortValues, nil
+}
+
+// earthRadiusKm is the mean radius used for haversine distances.
+const earthRadiusKm = 6371.0
+
+func distanceKm(lat1, long1, lat2, long2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLong := (long2 - long1) * toRad
+
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Pow(math.Sin(dLong/2), 2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
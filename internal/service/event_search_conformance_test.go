@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github/eventApp/internal/models"
+	"github/eventApp/internal/repository"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// The conformance suite runs the same searches against every search backend
+// and expects the same events back. It needs running backends and is skipped
+// unless TEST_DATABASE_URL, a Postgres DSN, and TEST_ELASTICSEARCH_URL are
+// set. The seeded events are far out in the Pacific so that other events in
+// the test databases don't match the searches.
+
+var conformanceCenter = models.GeoPoint{Latitude: 10, Longitude: -140}
+
+// conformanceEvents are named so that results can be compared by name, the
+// backends assign different IDs.
+func conformanceEvents(start time.Time) []*models.Event {
+	end := start.Add(4 * time.Hour)
+
+	return []*models.Event{
+		{
+			Name:        "Conformance lindy social",
+			GroupID:     1,
+			Time:        start,
+			Latitude:    conformanceCenter.Latitude,
+			Longitude:   conformanceCenter.Longitude,
+			Location:    "Conformance hall",
+			DanceStyles: []string{"Lindy Hop"},
+			Type:        "social",
+			Details:     &models.EventDetails{EndTime: &end, DJs: []string{"Ella"}},
+		},
+		{
+			// About 3 km east of the center.
+			Name:        "Conformance zorblax class",
+			GroupID:     1,
+			Time:        start,
+			Latitude:    10,
+			Longitude:   -139.97,
+			Location:    "Conformance hall",
+			DanceStyles: []string{"Balboa"},
+			Type:        "class",
+			Levels:      []string{"beginner"},
+			MinLevel:    1,
+			MaxLevel:    1,
+			Details:     &models.EventDetails{Teachers: []string{"Sam"}},
+		},
+		{
+			// About 33 km north of the center.
+			Name:        "Conformance blues workshop",
+			GroupID:     1,
+			Time:        start,
+			Latitude:    10.3,
+			Longitude:   -140,
+			Location:    "Conformance hall",
+			DanceStyles: []string{"Blues"},
+			Type:        "workshop",
+			Levels:      []string{"intermediate", "advanced"},
+			MinLevel:    3,
+			MaxLevel:    4,
+			Details:     &models.EventDetails{EndTime: &end, Teachers: []string{"Kim"}},
+		},
+	}
+}
+
+type searchBackend struct {
+	name     string
+	searcher eventSearchRep
+}
+
+// searchBackends seeds the conformance events into each backend and removes
+// them again when the test ends.
+func searchBackends(t *testing.T, events []*models.Event) []searchBackend {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	esURL := os.Getenv("TEST_ELASTICSEARCH_URL")
+	if dsn == "" || esURL == "" {
+		t.Skip("TEST_DATABASE_URL and TEST_ELASTICSEARCH_URL are needed for the search conformance suite")
+	}
+
+	ctx := context.Background()
+
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+
+	// Searching by text joins the groups and deleting events clears their
+	// RSVPs and queues them for the search index, so those tables are needed
+	// too.
+	_, err := repository.NewGroupRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating group repository: %v", err)
+	}
+	_, err = repository.NewRSVPRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating rsvp repository: %v", err)
+	}
+	_, err = repository.NewOutboxRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating outbox repository: %v", err)
+	}
+
+	eventRep, err := repository.NewEventRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating event repository: %v", err)
+	}
+
+	postgres, err := repository.NewEventPostgresSearchRepository(db, ctx)
+	if err != nil {
+		t.Fatalf("creating postgres search repository: %v", err)
+	}
+
+	es, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{esURL}})
+	if err != nil {
+		t.Fatalf("creating elasticsearch client: %v", err)
+	}
+
+	elastic, err := repository.NewEventSearchRepository(es, ctx)
+	if err != nil {
+		t.Fatalf("creating elasticsearch search repository: %v", err)
+	}
+
+	for _, event := range events {
+		seeded := *event
+
+		created, err := eventRep.CreateEvent(&seeded, ctx)
+		if err != nil {
+			t.Fatalf("seeding %q into postgres: %v", event.Name, err)
+		}
+		t.Cleanup(func() { eventRep.DeleteEvent(created.ID, ctx) })
+
+		err = elastic.IndexEvent(created, ctx)
+		if err != nil {
+			t.Fatalf("seeding %q into elasticsearch: %v", event.Name, err)
+		}
+		t.Cleanup(func() { elastic.RemoveEvent(created.ID, ctx) })
+	}
+
+	_, err = es.Indices.Refresh().Index("events").Do(ctx)
+	if err != nil {
+		t.Fatalf("refreshing elasticsearch: %v", err)
+	}
+
+	return []searchBackend{
+		{name: "elasticsearch", searcher: elastic},
+		{name: "postgres", searcher: postgres},
+	}
+}
+
+// search runs filter against a backend the way SearchEvents does, filtering
+// in memory what the backend leaves to the caller.
+func search(searcher eventSearchRep, filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	result, err := searcher.GetEvents(filter, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Facets == nil {
+		return filterEvents(result.Hits, filter)
+	}
+
+	return result, nil
+}
+
+func TestSearchConformance(t *testing.T) {
+	ctx := context.Background()
+
+	start := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Hour)
+	events := conformanceEvents(start)
+	backends := searchBackends(t, events)
+
+	seeded := make([]string, 0, len(events))
+	for _, event := range events {
+		seeded = append(seeded, event.Name)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.EventSearchFilter
+		want   []string
+		// facets are the expected dance style counts, nil to not check them.
+		facets map[string]int
+	}{
+		{
+			name:   "radius",
+			filter: models.EventSearchFilter{Distance: 5},
+			want:   []string{"Conformance lindy social", "Conformance zorblax class"},
+		},
+		{
+			name:   "wide radius",
+			filter: models.EventSearchFilter{Distance: 50},
+			want:   seeded,
+		},
+		{
+			name: "bounding box",
+			filter: models.EventSearchFilter{
+				BoundingBox: &models.BoundingBox{Top: 10.1, Left: -139.99, Bottom: 9.9, Right: -139.9},
+			},
+			want: []string{"Conformance zorblax class"},
+		},
+		{
+			name: "polygon",
+			filter: models.EventSearchFilter{
+				Area: []models.Polygon{{{
+					{Latitude: 10.2, Longitude: -140.1},
+					{Latitude: 10.2, Longitude: -139.9},
+					{Latitude: 10.4, Longitude: -139.9},
+					{Latitude: 10.4, Longitude: -140.1},
+					{Latitude: 10.2, Longitude: -140.1},
+				}}},
+			},
+			want: []string{"Conformance blues workshop"},
+		},
+		{
+			name:   "text",
+			filter: models.EventSearchFilter{Query: "zorblax"},
+			want:   []string{"Conformance zorblax class"},
+		},
+		{
+			name:   "dance style facet",
+			filter: models.EventSearchFilter{Distance: 50, DanceStyles: []string{"Balboa"}},
+			want:   []string{"Conformance zorblax class"},
+			facets: map[string]int{"Balboa": 1, "Blues": 1, "Lindy Hop": 1},
+		},
+		{
+			name:   "type facet",
+			filter: models.EventSearchFilter{Distance: 50, Types: []string{"social"}},
+			want:   []string{"Conformance lindy social"},
+		},
+		{
+			name:   "level facet",
+			filter: models.EventSearchFilter{Distance: 50, Levels: []string{"advanced"}},
+			want:   []string{"Conformance blues workshop"},
+		},
+		{
+			name:   "min level",
+			filter: models.EventSearchFilter{Distance: 50, MinLevel: 2},
+			want:   []string{"Conformance blues workshop"},
+		},
+		{
+			name:   "max level",
+			filter: models.EventSearchFilter{Distance: 50, MaxLevel: 2},
+			want:   []string{"Conformance zorblax class"},
+		},
+		{
+			name:   "detail",
+			filter: models.EventSearchFilter{Distance: 50, Details: map[string][]string{"teachers": {"Kim"}}},
+			want:   []string{"Conformance blues workshop"},
+		},
+	}
+
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				filter := tt.filter
+				filter.Latitude, filter.Longitude = conformanceCenter.Latitude, conformanceCenter.Longitude
+				filter.From, filter.To = start.Add(-time.Hour), start.Add(time.Hour)
+				filter.Size = maxSearchPageSize
+
+				result, err := search(backend.searcher, &filter, ctx)
+				if err != nil {
+					t.Fatalf("searching: %v", err)
+				}
+
+				// Other events in the test databases are ignored.
+				var got []string
+				for _, hit := range result.Hits {
+					if slices.Contains(seeded, hit.Event.Name) {
+						got = append(got, hit.Event.Name)
+					}
+				}
+
+				slices.Sort(got)
+				want := slices.Sorted(slices.Values(tt.want))
+				if !slices.Equal(got, want) {
+					t.Errorf("got events %v, want %v", got, want)
+				}
+
+				if tt.facets != nil {
+					facets := make(map[string]int)
+					for _, c := range result.Facets.DanceStyles {
+						facets[c.Value] = c.Count
+					}
+
+					if !maps.Equal(facets, tt.facets) {
+						t.Errorf("got dance style facets %v, want %v", facets, tt.facets)
+					}
+				}
+			})
+		}
+	}
+}
+
+// stubSearcher is a search backend without aggregations, answering every
+// search with the same hits.
+type stubSearcher struct {
+	eventSearchRep
+	hits []*models.EventSearchHit
+}
+
+func (s *stubSearcher) GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	return &models.EventSearchResult{Total: len(s.hits), Hits: s.hits}, nil
+}
+
+func (s *stubSearcher) GetEventStats(filter *models.EventSearchFilter, interval string, ctx context.Context) (*models.EventStats, error) {
+	return nil, models.ErrUnsupported
+}
+
+func TestGetEventStatsCountsForBackendsWithoutAggregations(t *testing.T) {
+	start := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Hour)
+
+	var hits []*models.EventSearchHit
+	for _, event := range conformanceEvents(start) {
+		hits = append(hits, &models.EventSearchHit{Event: event})
+	}
+
+	s := NewEventService(nil, &stubSearcher{hits: hits}, nil)
+
+	stats, err := s.GetEventStats(&EventStatsRequest{
+		SearchEventsRequest: SearchEventsRequest{
+			Latitude:  conformanceCenter.Latitude,
+			Longitude: conformanceCenter.Longitude,
+			Distance:  50,
+		},
+	}, context.Background())
+	if errors.Is(err, models.ErrUnsupported) {
+		t.Fatalf("ErrUnsupported reached the caller")
+	}
+	if err != nil {
+		t.Fatalf("GetEventStats: %v", err)
+	}
+
+	if stats.Total != 3 || stats.FromFallback {
+		t.Errorf("got total %d from fallback %v, want 3 counted from the backend's events", stats.Total, stats.FromFallback)
+	}
+}
+
+func TestGetEventStatsRejectsInvalidRequests(t *testing.T) {
+	now := time.Now()
+	s := NewEventService(nil, &stubSearcher{}, nil)
+
+	for _, esr := range []*EventStatsRequest{
+		{Interval: "fortnight"},
+		{SearchEventsRequest: SearchEventsRequest{From: now, To: now.Add(-time.Hour)}},
+	} {
+		_, err := s.GetEventStats(esr, context.Background())
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("got %v for %+v, want a validation error", err, esr)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	// Distance, start in milliseconds and ID, like the search index sorts.
+	sortValues := []any{3.25, int64(1780000000123), 42}
+
+	cursor, err := encodeCursor(sortValues)
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+
+	want := []json.Number{"3.25", "1780000000123", "42"}
+	if len(decoded) != len(want) {
+		t.Fatalf("got %d sort values, want %d", len(decoded), len(want))
+	}
+
+	for i, v := range decoded {
+		if v != want[i] {
+			t.Errorf("sort value %d: got %#v, want %#v", i, v, want[i])
+		}
+	}
+
+	if compareSortValues(decoded, []any{3.25, float64(1780000000123), float64(42)}) != 0 {
+		t.Errorf("decoded cursor doesn't compare equal to the sort values it came from")
+	}
+}
+
+func TestCursorEmpty(t *testing.T) {
+	cursor, err := encodeCursor(nil)
+	if err != nil || cursor != "" {
+		t.Fatalf("got cursor %q (%v) for no sort values, want none", cursor, err)
+	}
+
+	decoded, err := decodeCursor("")
+	if err != nil || decoded != nil {
+		t.Fatalf("got %v (%v) for no cursor, want none", decoded, err)
+	}
+}
+
+func TestCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "eyJhIjoxfQ"} {
+		_, err := decodeCursor(cursor)
+		if err == nil {
+			t.Errorf("decodeCursor(%q) succeeded", cursor)
+		}
+	}
+}
+
+// erroringSearcher fails every search with err.
+type erroringSearcher struct {
+	eventSearchRep
+	err      error
+	searches int
+}
+
+func (s *erroringSearcher) GetEvents(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	s.searches++
+	return nil, s.err
+}
+
+// emptyFallback finds nothing.
+type emptyFallback struct {
+	eventSearchFallbackRep
+	searches int
+}
+
+func (f *emptyFallback) GetEventsNear(filter *models.EventSearchFilter, ctx context.Context) (*models.EventSearchResult, error) {
+	f.searches++
+	return &models.EventSearchResult{}, nil
+}
+
+func TestSearchBreakerIgnoresInvalidSearches(t *testing.T) {
+	ctx := context.Background()
+
+	searcher := &erroringSearcher{err: models.Invalidf("invalid search: parse_exception")}
+	fallback := &emptyFallback{}
+
+	s := NewEventService(nil, searcher, nil)
+	s.UseSearchFallback(fallback, 2, time.Hour, time.Second)
+
+	for i := 0; i < 3; i++ {
+		_, fromFallback, err := s.searchEvents(&models.EventSearchFilter{}, ctx)
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) || fromFallback {
+			t.Fatalf("search %d: got error %v from fallback %v, want the validation error from the backend", i, err, fromFallback)
+		}
+	}
+
+	if searcher.searches != 3 || fallback.searches != 0 {
+		t.Fatalf("got %d backend and %d fallback searches, want every search on the backend", searcher.searches, fallback.searches)
+	}
+
+	// Unavailable backends do open the breaker.
+	searcher.err = errors.New("connection refused")
+
+	for i := 0; i < 3; i++ {
+		_, fromFallback, err := s.searchEvents(&models.EventSearchFilter{}, ctx)
+		if err != nil || !fromFallback {
+			t.Fatalf("search %d: got error %v from fallback %v, want the fallback's result", i, err, fromFallback)
+		}
+	}
+
+	if searcher.searches != 5 || fallback.searches != 3 {
+		t.Errorf("got %d backend and %d fallback searches, want the breaker open after two failures", searcher.searches, fallback.searches)
+	}
+}
+
+func TestSearchEventsRejectsInvalidSearches(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	square := [][2]float64{{52, 13}, {52, 14}, {53, 14}, {53, 13}}
+
+	tests := []struct {
+		name string
+		ser  SearchEventsRequest
+	}{
+		{"nothing to search by", SearchEventsRequest{}},
+		{"from after to", SearchEventsRequest{Query: "lindy", From: now, To: now.Add(-time.Hour)}},
+		{"size too large", SearchEventsRequest{Query: "lindy", Size: maxSearchPageSize + 1}},
+		{"negative size", SearchEventsRequest{Query: "lindy", Size: -1}},
+		{"bad cursor", SearchEventsRequest{Query: "lindy", Cursor: "not a cursor"}},
+		{"unknown region", SearchEventsRequest{Region: "Atlantis"}},
+		{"region and polygon", SearchEventsRequest{Region: "Berlin", Polygon: square}},
+		{"polygon of two points", SearchEventsRequest{Polygon: square[:2]}},
+	}
+
+	s := NewEventService(nil, &stubSearcher{}, nil)
+
+	for _, tt := range tests {
+		_, err := s.SearchEvents(&tt.ser, ctx)
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: got %v, want a validation error", tt.name, err)
+		}
+	}
+}
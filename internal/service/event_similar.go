@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const similarEventsSize = 10
+
+// similarRadiusKm bounds where similar events are looked for when scoring
+// them in memory.
+const similarRadiusKm = 100
+
+// The proximity decays of the search index, scores halve at scale past the
+// offset.
+const (
+	similarGeoScaleKm    = 25
+	similarGeoOffsetKm   = 2
+	similarTimeScaleDays = 14
+	similarTimeOffsetDay = 1
+)
+
+// GetSimilarEvents finds upcoming events like the given one, for "you might
+// also like" suggestions on its page.
+func (e *EventService) GetSimilarEvents(groupID, eventID int64, ctx context.Context) ([]*GetEventResponse, error) {
+	event, err := eventInGroup(e.eventRep, groupID, eventID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recurring events are compared by their next occurrence.
+	now := time.Now()
+	occurrences, err := expandAll([]*models.Event{event}, now, now.Add(recurrenceHorizon))
+	if err != nil {
+		return nil, err
+	}
+	if len(occurrences) > 0 {
+		event = occurrences[0]
+	}
+
+	var similar []*models.Event
+
+	filter := &models.EventSearchFilter{
+		Latitude:  event.Latitude,
+		Longitude: event.Longitude,
+		Distance:  similarRadiusKm,
+		From:      now,
+	}
+
+	_, err = e.withSearchFallback(func(ctx context.Context) error {
+		var err error
+		similar, err = e.eventSearcher.GetSimilarEvents(event, similarEventsSize, ctx)
+		if !errors.Is(err, models.ErrUnsupported) {
+			return err
+		}
+
+		// Backends without scoring functions leave ranking to us.
+		result, err := e.eventSearcher.GetEvents(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		similar, err = similarEvents(result.Hits, event, filter)
+		return err
+	}, func(ctx context.Context) error {
+		result, err := e.searchFallback.GetEventsNear(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		similar, err = similarEvents(result.Hits, event, filter)
+		return err
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsResp := make([]*GetEventResponse, 0, len(similar))
+	for _, s := range similar {
+		eventsResp = append(eventsResp, newGetEventResponse(s))
+	}
+
+	err = e.addRSVPCounts(eventsResp, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return eventsResp, nil
+}
+
+// similarEvents does in memory what the search index scoring does for
+// backends that return every matching event as a series: it rewards shared
+// words, dance styles, levels and type and decays with distance and time.
+func similarEvents(hits []*models.EventSearchHit, event *models.Event, filter *models.EventSearchFilter) ([]*models.Event, error) {
+	result, err := filterEvents(hits, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	words := eventWords(event)
+
+	type scored struct {
+		event *models.Event
+		score float64
+	}
+
+	var candidates []scored
+	for _, hit := range distinctHits(result.Hits) {
+		other := hit.Event
+		if other.ID == event.ID {
+			continue
+		}
+
+		relevance := 2*overlap(event.DanceStyles, other.DanceStyles) +
+			overlap(event.Levels, other.Levels) +
+			overlap(words, eventWords(other))
+		if event.Type != "" && event.Type == other.Type {
+			relevance++
+		}
+		if relevance == 0 {
+			continue
+		}
+
+		km := distanceKm(event.Latitude, event.Longitude, other.Latitude, other.Longitude)
+		days := math.Abs(other.Time.Sub(event.Time).Hours()) / 24
+
+		candidates = append(candidates, scored{
+			event: other,
+			score: float64(relevance) *
+				gaussDecay(km, similarGeoScaleKm, similarGeoOffsetKm) *
+				gaussDecay(days, similarTimeScaleDays, similarTimeOffsetDay),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	similar := make([]*models.Event, 0, min(len(candidates), similarEventsSize))
+	for _, c := range candidates[:min(len(candidates), similarEventsSize)] {
+		similar = append(similar, c.event)
+	}
+
+	return similar, nil
+}
+
+// eventWords are the lower cased words of an event's name and its group's
+// keywords, skipping short ones.
+func eventWords(event *models.Event) []string {
+	var words []string
+	for _, text := range append([]string{event.Name}, event.GroupKeyWords...) {
+		for _, w := range strings.Fields(strings.ToLower(text)) {
+			if len(w) > 2 && !slices.Contains(words, w) {
+				words = append(words, w)
+			}
+		}
+	}
+	return words
+}
+
+func overlap(a, b []string) int {
+	n := 0
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			n++
+		}
+	}
+	return n
+}
+
+// gaussDecay is Elasticsearch's gauss decay function with a decay of 0.5.
+func gaussDecay(value, scale, offset float64) float64 {
+	d := max(0, value-offset) / scale
+	return math.Pow(0.5, d*d)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+type EventStatsRequest struct {
+	SearchEventsRequest
+	// Interval is the date histogram interval, day, week or month.
+	Interval string
+}
+
+const defaultStatsInterval = "week"
+
+var statsIntervals = []string{"day", "week", "month"}
+
+type WeekdayCountResponse struct {
+	Weekday string `json:"weekday"`
+	Count   int    `json:"count"`
+}
+
+type HourCountResponse struct {
+	Hour  int `json:"hour"`
+	Count int `json:"count"`
+}
+
+type DateCountResponse struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+type EventStatsResponse struct {
+	Total       int                    `json:"total"`
+	DanceStyles []FacetCountResponse   `json:"danceStyles"`
+	Levels      []FacetCountResponse   `json:"levels"`
+	Types       []FacetCountResponse   `json:"types"`
+	Weekdays    []WeekdayCountResponse `json:"weekdays"`
+	Hours       []HourCountResponse    `json:"hours"`
+	Interval    string                 `json:"interval"`
+	Histogram   []DateCountResponse    `json:"histogram"`
+	// FromFallback is set when the search backend was unavailable and the
+	// events came from Postgres.
+	FromFallback bool `json:"-"`
+}
+
+// GetEventStats counts the upcoming occurrences matching the search filters
+// per dance style, level, type, weekday and hour, and over time, so organizers
+// can see which nights and styles are already busy.
+func (e *EventService) GetEventStats(esr *EventStatsRequest, ctx context.Context) (*EventStatsResponse, error) {
+	interval := esr.Interval
+	if interval == "" {
+		interval = defaultStatsInterval
+	}
+	if !slices.Contains(statsIntervals, interval) {
+		return nil, models.Invalidf("interval has to be one of %s", strings.Join(statsIntervals, ", "))
+	}
+
+	if !esr.From.IsZero() && !esr.To.IsZero() && !esr.From.Before(esr.To) {
+		return nil, models.Invalidf("from has to be before to")
+	}
+
+	filter, err := e.newSearchFilter(&esr.SearchEventsRequest, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.From.IsZero() {
+		filter.From = time.Now()
+	}
+
+	var stats *models.EventStats
+
+	fromFallback, err := e.withSearchFallback(func(ctx context.Context) error {
+		var err error
+		stats, err = e.eventSearcher.GetEventStats(filter, interval, ctx)
+		if !errors.Is(err, models.ErrUnsupported) {
+			return err
+		}
+
+		// Backends without aggregations leave counting to us.
+		result, err := e.eventSearcher.GetEvents(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		stats, err = eventStats(result.Hits, filter, interval)
+		return err
+	}, func(ctx context.Context) error {
+		result, err := e.searchFallback.GetEventsNear(filter, ctx)
+		if err != nil {
+			return err
+		}
+
+		stats, err = eventStats(result.Hits, filter, interval)
+		return err
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statsResp := &EventStatsResponse{
+		Total:        stats.Total,
+		DanceStyles:  newFacetCountsResponse(stats.DanceStyles),
+		Levels:       newFacetCountsResponse(stats.Levels),
+		Types:        newFacetCountsResponse(stats.Types),
+		Weekdays:     make([]WeekdayCountResponse, 0, len(stats.Weekdays)),
+		Hours:        make([]HourCountResponse, 0, len(stats.Hours)),
+		Interval:     interval,
+		Histogram:    make([]DateCountResponse, 0, len(stats.Histogram)),
+		FromFallback: fromFallback,
+	}
+
+	// Weeks start on Monday, like the histogram's.
+	for i := range 7 {
+		day := time.Weekday((i + 1) % 7)
+		statsResp.Weekdays = append(statsResp.Weekdays, WeekdayCountResponse{
+			Weekday: strings.ToLower(day.String()),
+			Count:   stats.Weekdays[day],
+		})
+	}
+
+	for hour, count := range stats.Hours {
+		statsResp.Hours = append(statsResp.Hours, HourCountResponse{Hour: hour, Count: count})
+	}
+
+	for _, c := range stats.Histogram {
+		statsResp.Histogram = append(statsResp.Histogram, DateCountResponse(c))
+	}
+
+	return statsResp, nil
+}
+
+// eventStats does in memory what the search index aggregations do for
+// backends that return every matching event as a series.
+func eventStats(hits []*models.EventSearchHit, filter *models.EventSearchFilter, interval string) (*models.EventStats, error) {
+	result, err := filterEvents(hits, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.EventStats{Total: len(result.Hits)}
+	danceStyles := make(map[string]int)
+	levels := make(map[string]int)
+	types := make(map[string]int)
+	histogram := make(map[time.Time]int)
+
+	for _, hit := range result.Hits {
+		event := hit.Event
+
+		for _, style := range event.DanceStyles {
+			danceStyles[style]++
+		}
+		for _, level := range event.Levels {
+			levels[level]++
+		}
+		if event.Type != "" {
+			types[event.Type]++
+		}
+
+		local := event.Time
+		if loc, err := time.LoadLocation(event.Timezone); err == nil {
+			local = event.Time.In(loc)
+		}
+		stats.Weekdays[local.Weekday()]++
+		stats.Hours[local.Hour()]++
+
+		histogram[intervalStart(event.Time, interval)]++
+	}
+
+	stats.DanceStyles = sortedFacetCounts(danceStyles)
+	stats.Levels = sortedFacetCounts(levels)
+	stats.Types = sortedFacetCounts(types)
+
+	// Like a date histogram, intervals between the first and the last one
+	// are there even when empty.
+	if len(histogram) > 0 {
+		first, last := time.Time{}, time.Time{}
+		for start := range histogram {
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+			if start.After(last) {
+				last = start
+			}
+		}
+
+		for start := first; !start.After(last); start = nextInterval(start, interval) {
+			stats.Histogram = append(stats.Histogram, models.DateCount{Start: start, Count: histogram[start]})
+		}
+	}
+
+	return stats, nil
+}
+
+// intervalStart returns the UTC start of the day, week or month t falls in.
+func intervalStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch interval {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func nextInterval(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
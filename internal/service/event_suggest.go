@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"strings"
+)
+
+// suggestionSize is the number of suggestions per group.
+const suggestionSize = 5
+
+type EventSuggestionsResponse struct {
+	Names       []string `json:"names"`
+	Locations   []string `json:"locations"`
+	DanceStyles []string `json:"danceStyles"`
+	// FromFallback is set when the search backend was unavailable and the
+	// suggestions came from Postgres.
+	FromFallback bool `json:"-"`
+}
+
+// SuggestEvents completes what a user started typing into the search box to
+// event names, locations and dance styles.
+func (e *EventService) SuggestEvents(prefix string, ctx context.Context) (*EventSuggestionsResponse, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return nil, fmt.Errorf("a prefix is required")
+	}
+
+	var suggestions *models.EventSuggestions
+
+	fromFallback, err := e.withSearchFallback(func(ctx context.Context) error {
+		var err error
+		suggestions, err = e.eventSearcher.GetSuggestions(prefix, suggestionSize, ctx)
+		return err
+	}, func(ctx context.Context) error {
+		var err error
+		suggestions, err = e.searchFallback.GetSuggestions(prefix, suggestionSize, ctx)
+		return err
+	}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventSuggestionsResponse{
+		Names:        suggestions.Names,
+		Locations:    suggestions.Locations,
+		DanceStyles:  suggestions.DanceStyles,
+		FromFallback: fromFallback,
+	}, nil
+}
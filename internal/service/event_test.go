@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestDeleteEventChecksGroup(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	event, _ := events.CreateEvent(&models.Event{Name: "Friday social", GroupID: 7}, ctx)
+
+	s := NewEventService(events, nil, nil)
+
+	err := s.DeleteEvent(8, event.ID, ctx)
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("deleting through another group: got %v, want ErrNotFound", err)
+	}
+
+	if _, ok := events.events[event.ID]; !ok {
+		t.Fatalf("event deleted through another group")
+	}
+
+	err = s.DeleteEvent(7, event.ID, ctx)
+	if err != nil {
+		t.Fatalf("deleting through its group: %v", err)
+	}
+
+	if _, ok := events.events[event.ID]; ok {
+		t.Fatalf("event not deleted through its group")
+	}
+}
+
+func TestUpdateEventChecksGroup(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	event, _ := events.CreateEvent(&models.Event{Name: "Friday social", GroupID: 7}, ctx)
+
+	s := NewEventService(events, nil, nil)
+
+	_, err := s.UpdateEvent(8, event.ID, &UpdateEventRequest{Name: "Taken over", GroupID: 8}, ctx)
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("updating through another group: got %v, want ErrNotFound", err)
+	}
+
+	if got := events.events[event.ID]; got.Name != "Friday social" || got.GroupID != 7 {
+		t.Fatalf("event changed through another group: %+v", got)
+	}
+
+	updated, err := s.UpdateEvent(7, event.ID, &UpdateEventRequest{Name: "Friday social, renamed", GroupID: 8}, ctx)
+	if err != nil {
+		t.Fatalf("updating through its group: %v", err)
+	}
+
+	if updated.Name != "Friday social, renamed" || updated.GroupID != 7 {
+		t.Errorf("got %q in group %d, want the new name in group 7", updated.Name, updated.GroupID)
+	}
+}
+
+func TestUpdateEventKeepsUnchangedLegacyLevels(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	event, _ := events.CreateEvent(&models.Event{
+		Name:        "Friday social",
+		GroupID:     7,
+		DanceStyles: []string{"Lindy Hop"},
+		Levels:      []string{"all levels", "Advanced"},
+		MinLevel:    1,
+		MaxLevel:    4,
+	}, ctx)
+
+	s := NewEventService(events, nil, nil)
+
+	updated, err := s.UpdateEvent(7, event.ID, &UpdateEventRequest{
+		Name:        "Friday social, renamed",
+		GroupID:     7,
+		DanceStyles: []string{"Lindy Hop"},
+		Levels:      []string{"all levels", "Advanced"},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("updating with unchanged legacy levels: %v", err)
+	}
+
+	if !slices.Equal(updated.Levels, []string{"all levels", "Advanced"}) {
+		t.Errorf("got levels %v, want the stored ones kept", updated.Levels)
+	}
+
+	if stored := events.events[event.ID]; stored.MinLevel != 1 || stored.MaxLevel != 4 {
+		t.Errorf("got levels from %d to %d, want the stored range 1 to 4 kept", stored.MinLevel, stored.MaxLevel)
+	}
+
+	_, err = s.UpdateEvent(7, event.ID, &UpdateEventRequest{
+		Name:        "Friday social",
+		GroupID:     7,
+		DanceStyles: []string{"Lindy Hop"},
+		Levels:      []string{"advanced", "pro"},
+	}, ctx)
+	if err == nil {
+		t.Errorf("updating with a new unknown level succeeded")
+	}
+}
+
+func TestNormalizeLevels(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	legacy, _ := events.CreateEvent(&models.Event{Name: "Legacy", Levels: []string{"Intermediate", "all levels", "beginner"}}, ctx)
+	current, _ := events.CreateEvent(&models.Event{Name: "Current", Levels: []string{"improver"}, MinLevel: 2, MaxLevel: 2}, ctx)
+
+	s := NewEventService(events, nil, nil)
+
+	changed, err := s.NormalizeLevels(ctx)
+	if err != nil {
+		t.Fatalf("NormalizeLevels: %v", err)
+	}
+
+	if changed != 1 {
+		t.Errorf("changed %d events, want 1", changed)
+	}
+
+	got := events.events[legacy.ID]
+	if !slices.Equal(got.Levels, []string{"beginner", "intermediate"}) || got.MinLevel != 1 || got.MaxLevel != 3 {
+		t.Errorf("got levels %v from %d to %d, want beginner and intermediate from 1 to 3", got.Levels, got.MinLevel, got.MaxLevel)
+	}
+
+	if got := events.events[current.ID]; !slices.Equal(got.Levels, []string{"improver"}) {
+		t.Errorf("event already on the scale changed to %v", got.Levels)
+	}
+}
+
+func TestCreateEventRejectsInvalidEvents(t *testing.T) {
+	ctx := context.Background()
+
+	valid := func() *CreateEventRequest {
+		return &CreateEventRequest{Name: "Friday social", GroupID: 7, DanceStyles: []string{"Lindy Hop"}}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*CreateEventRequest)
+	}{
+		{"negative capacity", func(cer *CreateEventRequest) { cer.Capacity = -1 }},
+		{"negative max role imbalance", func(cer *CreateEventRequest) { cer.MaxRoleImbalance = -1 }},
+		{"unknown level", func(cer *CreateEventRequest) { cer.Levels = []string{"pro"} }},
+		{"unknown type", func(cer *CreateEventRequest) { cer.Type = "rave" }},
+		{"invalid timezone", func(cer *CreateEventRequest) { cer.Timezone = "Mars/Olympus" }},
+		{"recurring without timezone", func(cer *CreateEventRequest) { cer.Recurrence = &Recurrence{RRule: "FREQ=WEEKLY"} }},
+		{"invalid rule", func(cer *CreateEventRequest) {
+			cer.Timezone = "Europe/Berlin"
+			cer.Recurrence = &Recurrence{RRule: "FREQ=SOMETIMES"}
+		}},
+	}
+
+	s := NewEventService(newFakeEventStore(), nil, nil)
+
+	for _, tt := range tests {
+		cer := valid()
+		tt.change(cer)
+
+		_, err := s.CreateEvent(cer, ctx)
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: got %v, want a validation error", tt.name, err)
+		}
+	}
+}
+
+func TestGetSimilarEventsChecksGroup(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	event, _ := events.CreateEvent(&models.Event{Name: "Friday social", GroupID: 7}, ctx)
+
+	s := NewEventService(events, &stubSearcher{}, nil)
+
+	_, err := s.GetSimilarEvents(8, event.ID, ctx)
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("similar events through another group: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github/eventApp/internal/models"
+	"math"
+	"strings"
+	"time"
+)
+
+// maxTileEvents caps the points in a single tile.
+const maxTileEvents = 5000
+
+// Field numbers and constants of the Mapbox vector tile protobuf schema, see
+// https://github.com/mapbox/vector-tile-spec/blob/master/2.1/vector_tile.proto
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+	layerVersion  = 15
+
+	featureID       = 1
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueDouble = 3
+	valueSint   = 6
+	valueBool   = 7
+
+	geomTypePoint = 1
+	commandMoveTo = 1
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+
+	tileVersion = 2
+	tileExtent  = 4096
+)
+
+// eventsLayer is the name of the vector tile layer holding the events.
+const eventsLayer = "events"
+
+type EventTileRequest struct {
+	SearchEventsRequest
+	Z int
+	X int
+	Y int
+}
+
+type EventTileResponse struct {
+	Tile []byte
+	// FromFallback is set when the search backend was unavailable and the
+	// events came from Postgres.
+	FromFallback bool
+}
+
+// EventTile renders the events inside a map tile as a Mapbox vector tile,
+// one point per event at its next occurrence, with the same filters as the
+// event search.
+func (e *EventService) EventTile(etr *EventTileRequest, ctx context.Context) (*EventTileResponse, error) {
+	if etr.Z < 0 || etr.Z > maxTileZoom {
+		return nil, models.Invalidf("zoom has to be between 0 and %d", maxTileZoom)
+	}
+
+	if n := 1 << etr.Z; etr.X < 0 || etr.X >= n || etr.Y < 0 || etr.Y >= n {
+		return nil, models.Invalidf("invalid tile %d/%d/%d", etr.Z, etr.X, etr.Y)
+	}
+
+	if !etr.From.IsZero() && !etr.To.IsZero() && !etr.From.Before(etr.To) {
+		return nil, models.Invalidf("from has to be before to")
+	}
+
+	filter, err := e.newSearchFilter(&etr.SearchEventsRequest, ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter.BoundingBox = tileBounds(etr.X, etr.Y, etr.Z)
+	filter.Size = maxTileEvents
+
+	if filter.From.IsZero() {
+		filter.From = time.Now()
+	}
+
+	result, fromFallback, err := e.searchDistinctEvents(filter, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	layer := newTileLayer(eventsLayer)
+	for _, hit := range result.Hits {
+		fx, fy := tileFraction(hit.Event.Latitude, hit.Event.Longitude, etr.Z)
+		x := int64(math.Round((fx - float64(etr.X)) * tileExtent))
+		y := int64(math.Round((fy - float64(etr.Y)) * tileExtent))
+
+		// Events on the far edge belong to the neighbouring tile.
+		if x < 0 || x >= tileExtent || y < 0 || y >= tileExtent {
+			continue
+		}
+
+		layer.addPoint(uint64(hit.Event.ID), x, y, eventTileProperties(hit.Event))
+	}
+
+	return &EventTileResponse{Tile: layer.marshalTile(), FromFallback: fromFallback}, nil
+}
+
+// eventTileProperties only keeps what maps style and filter points by.
+// Vector tiles have no lists, so dance styles and levels are comma separated.
+func eventTileProperties(event *models.Event) []tileProperty {
+	return []tileProperty{
+		{"id", event.ID},
+		{"groupId", event.GroupID},
+		{"name", event.Name},
+		{"type", event.Type},
+		{"danceStyles", strings.Join(event.DanceStyles, ",")},
+		{"levels", strings.Join(event.Levels, ",")},
+		{"time", event.Time.UTC().Format(time.RFC3339)},
+		{"cancelled", event.Cancelled},
+	}
+}
+
+type tileProperty struct {
+	key string
+	// value is a string, int64, float64 or bool.
+	value any
+}
+
+// tileLayer encodes a single vector tile layer of points. Keys and values are
+// shared between features like the format expects.
+type tileLayer struct {
+	name     string
+	keys     []string
+	keyIndex map[string]uint64
+	values   [][]byte
+	valIndex map[any]uint64
+	features [][]byte
+}
+
+func newTileLayer(name string) *tileLayer {
+	return &tileLayer{
+		name:     name,
+		keyIndex: make(map[string]uint64),
+		valIndex: make(map[any]uint64),
+	}
+}
+
+func (l *tileLayer) addPoint(id uint64, x, y int64, properties []tileProperty) {
+	var tags []byte
+	for _, p := range properties {
+		tags = binary.AppendUvarint(tags, l.key(p.key))
+		tags = binary.AppendUvarint(tags, l.value(p.value))
+	}
+
+	var geometry []byte
+	geometry = binary.AppendUvarint(geometry, commandMoveTo|1<<3)
+	geometry = binary.AppendUvarint(geometry, zigzag(x))
+	geometry = binary.AppendUvarint(geometry, zigzag(y))
+
+	var feature []byte
+	feature = appendVarintField(feature, featureID, id)
+	feature = appendBytesField(feature, featureTags, tags)
+	feature = appendVarintField(feature, featureType, geomTypePoint)
+	feature = appendBytesField(feature, featureGeometry, geometry)
+
+	l.features = append(l.features, feature)
+}
+
+func (l *tileLayer) key(k string) uint64 {
+	i, ok := l.keyIndex[k]
+	if !ok {
+		i = uint64(len(l.keys))
+		l.keyIndex[k] = i
+		l.keys = append(l.keys, k)
+	}
+	return i
+}
+
+func (l *tileLayer) value(v any) uint64 {
+	i, ok := l.valIndex[v]
+	if ok {
+		return i
+	}
+
+	var value []byte
+	switch t := v.(type) {
+	case string:
+		value = appendBytesField(value, valueString, []byte(t))
+	case int64:
+		value = appendVarintField(value, valueSint, zigzag(t))
+	case float64:
+		value = binary.AppendUvarint(value, valueDouble<<3|wireFixed64)
+		value = binary.LittleEndian.AppendUint64(value, math.Float64bits(t))
+	case bool:
+		b := uint64(0)
+		if t {
+			b = 1
+		}
+		value = appendVarintField(value, valueBool, b)
+	default:
+		value = appendBytesField(value, valueString, []byte(fmt.Sprint(t)))
+	}
+
+	i = uint64(len(l.values))
+	l.valIndex[v] = i
+	l.values = append(l.values, value)
+	return i
+}
+
+// marshalTile encodes a tile holding just this layer.
+func (l *tileLayer) marshalTile() []byte {
+	var layer []byte
+	layer = appendVarintField(layer, layerVersion, tileVersion)
+	layer = appendBytesField(layer, layerName, []byte(l.name))
+	for _, f := range l.features {
+		layer = appendBytesField(layer, layerFeatures, f)
+	}
+	for _, k := range l.keys {
+		layer = appendBytesField(layer, layerKeys, []byte(k))
+	}
+	for _, v := range l.values {
+		layer = appendBytesField(layer, layerValues, v)
+	}
+	layer = appendVarintField(layer, layerExtent, tileExtent)
+
+	return appendBytesField(nil, tileLayers, layer)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireVarint))
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github/eventApp/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// protoField is a decoded protobuf field, value holds varints and data the
+// bytes of length delimited fields.
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+// decodeProto decodes the varint and length delimited fields vector tiles
+// are made of.
+func decodeProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid field key")
+		}
+		b = b[n:]
+
+		f := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("invalid varint in field %d", f.number)
+			}
+			b = b[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				t.Fatalf("invalid length in field %d", f.number)
+			}
+			f.data = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d in field %d", key&7, f.number)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func fieldsNumbered(fields []protoField, number int) []protoField {
+	var numbered []protoField
+	for _, f := range fields {
+		if f.number == number {
+			numbered = append(numbered, f)
+		}
+	}
+	return numbered
+}
+
+func decodeVarints(t *testing.T, b []byte) []uint64 {
+	t.Helper()
+
+	var values []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid packed varint")
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func TestTileLayerEncoding(t *testing.T) {
+	layer := newTileLayer(eventsLayer)
+	layer.addPoint(1, 10, 20, []tileProperty{{"type", "social"}, {"cancelled", false}})
+	layer.addPoint(2, 4095, 0, []tileProperty{{"type", "social"}, {"cancelled", true}})
+
+	tile := decodeProto(t, layer.marshalTile())
+	layers := fieldsNumbered(tile, tileLayers)
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want 1", len(layers))
+	}
+
+	fields := decodeProto(t, layers[0].data)
+
+	if name := fieldsNumbered(fields, layerName); len(name) != 1 || string(name[0].data) != eventsLayer {
+		t.Errorf("layer not named %q", eventsLayer)
+	}
+	if version := fieldsNumbered(fields, layerVersion); len(version) != 1 || version[0].value != tileVersion {
+		t.Errorf("layer version not %d", tileVersion)
+	}
+	if extent := fieldsNumbered(fields, layerExtent); len(extent) != 1 || extent[0].value != tileExtent {
+		t.Errorf("layer extent not %d", tileExtent)
+	}
+
+	var keys []string
+	for _, k := range fieldsNumbered(fields, layerKeys) {
+		keys = append(keys, string(k.data))
+	}
+	if !slices.Equal(keys, []string{"type", "cancelled"}) {
+		t.Errorf("got keys %v, want each key once", keys)
+	}
+
+	// "social" is shared, false and true are values of their own.
+	if values := fieldsNumbered(fields, layerValues); len(values) != 3 {
+		t.Errorf("got %d values, want 3", len(values))
+	}
+
+	features := fieldsNumbered(fields, layerFeatures)
+	if len(features) != 2 {
+		t.Fatalf("got %d features, want 2", len(features))
+	}
+
+	second := decodeProto(t, features[1].data)
+
+	if id := fieldsNumbered(second, featureID); len(id) != 1 || id[0].value != 2 {
+		t.Errorf("second feature doesn't have ID 2")
+	}
+	if geomType := fieldsNumbered(second, featureType); len(geomType) != 1 || geomType[0].value != geomTypePoint {
+		t.Errorf("second feature isn't a point")
+	}
+
+	tags := decodeVarints(t, fieldsNumbered(second, featureTags)[0].data)
+	if !slices.Equal(tags, []uint64{0, 0, 1, 2}) {
+		t.Errorf("got tags %v, want the shared type value and its own cancelled value", tags)
+	}
+
+	geometry := decodeVarints(t, fieldsNumbered(second, featureGeometry)[0].data)
+	if !slices.Equal(geometry, []uint64{commandMoveTo | 1<<3, zigzag(4095), zigzag(0)}) {
+		t.Errorf("got geometry %v, want a single move to 4095, 0", geometry)
+	}
+}
+
+func TestEventTileKeepsEventsInsideTheTile(t *testing.T) {
+	start := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Hour)
+
+	hits := []*models.EventSearchHit{
+		{Event: &models.Event{ID: 1, Name: "Berlin social", Time: start, Latitude: 52.52, Longitude: 13.405}},
+		{Event: &models.Event{ID: 2, Name: "New York social", Time: start, Latitude: 40.71, Longitude: -74.01}},
+	}
+
+	s := NewEventService(nil, &stubSearcher{hits: hits}, nil)
+
+	// The north eastern quarter of the world.
+	resp, err := s.EventTile(&EventTileRequest{Z: 1, X: 1, Y: 0}, context.Background())
+	if err != nil {
+		t.Fatalf("EventTile: %v", err)
+	}
+
+	layer := decodeProto(t, fieldsNumbered(decodeProto(t, resp.Tile), tileLayers)[0].data)
+
+	var ids []uint64
+	for _, f := range fieldsNumbered(layer, layerFeatures) {
+		ids = append(ids, fieldsNumbered(decodeProto(t, f.data), featureID)[0].value)
+	}
+
+	if !slices.Equal(ids, []uint64{1}) {
+		t.Errorf("got events %v in the tile, want only the Berlin one", ids)
+	}
+}
+
+func TestEventTileRejectsInvalidTiles(t *testing.T) {
+	s := NewEventService(nil, &stubSearcher{}, nil)
+
+	for _, etr := range []*EventTileRequest{
+		{Z: -1},
+		{Z: maxTileZoom + 1},
+		{Z: 2, X: 4},
+		{Z: 2, Y: -1},
+	} {
+		_, err := s.EventTile(etr, context.Background())
+
+		var invalid *models.ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("tile %d/%d/%d: got %v, want a validation error", etr.Z, etr.X, etr.Y, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+// EventFeatureCollectionResponse is an RFC 7946 GeoJSON FeatureCollection of
+// events. Search metadata is carried as foreign members next to the features.
+type EventFeatureCollectionResponse struct {
+	Type       string                  `json:"type"`
+	Features   []*EventFeatureResponse `json:"features"`
+	Total      *int                    `json:"total,omitempty"`
+	Facets     *EventFacetsResponse    `json:"facets,omitempty"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+type EventFeatureResponse struct {
+	Type       string            `json:"type"`
+	ID         int64             `json:"id"`
+	Geometry   PointResponse     `json:"geometry"`
+	Properties *GetEventResponse `json:"properties"`
+}
+
+type PointResponse struct {
+	Type string `json:"type"`
+	// Coordinates are longitude first, then latitude.
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func NewEventFeatureCollection(events []*GetEventResponse) *EventFeatureCollectionResponse {
+	fc := &EventFeatureCollectionResponse{
+		Type:     "FeatureCollection",
+		Features: make([]*EventFeatureResponse, 0, len(events)),
+	}
+
+	for _, event := range events {
+		fc.Features = append(fc.Features, &EventFeatureResponse{
+			Type: "Feature",
+			ID:   event.ID,
+			Geometry: PointResponse{
+				Type:        "Point",
+				Coordinates: [2]float64{event.Longitude, event.Latitude},
+			},
+			Properties: event,
+		})
+	}
+
+	return fc
+}
+
+// FeatureCollection returns the search results as GeoJSON.
+func (ser *SearchEventsResponse) FeatureCollection() *EventFeatureCollectionResponse {
+	fc := NewEventFeatureCollection(ser.Events)
+	fc.Total = &ser.Total
+	fc.Facets = &ser.Facets
+	fc.NextCursor = ser.NextCursor
+	return fc
+}
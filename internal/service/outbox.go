@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+	"log"
+	"time"
+)
+
+const (
+	outboxBatchSize = 100
+	// outboxLease is how long a claimed entry is hidden from other workers.
+	outboxLease       = time.Minute
+	outboxMaxBackoff  = time.Hour
+	outboxDeadLetters = 50
+	// outboxRetention is how long processed entries are kept for reindexing.
+	outboxRetention = 24 * time.Hour
+)
+
+type outboxRep interface {
+	ClaimPending(limit int, lease time.Duration, ctx context.Context) ([]*models.OutboxEntry, error)
+	CompleteEntry(id int64, ctx context.Context) error
+	FailEntry(id int64, lastError string, nextAttemptAt time.Time, dead bool, ctx context.Context) error
+	GetStats(ctx context.Context) (*models.OutboxStats, error)
+	GetDeadEntries(limit int, ctx context.Context) ([]*models.OutboxEntry, error)
+	RetryDead(ctx context.Context) (int, error)
+	PurgeProcessed(before time.Time, ctx context.Context) error
+	EnqueueRecurring(ctx context.Context) (int, error)
+}
+
+// OutboxService drains the search outbox into Elasticsearch. Event writes
+// record an outbox entry in the same transaction, so the index catches up
+// with Postgres even if Elasticsearch was down when the event changed.
+type OutboxService struct {
+	outboxRep   outboxRep
+	events      *EventService
+	maxAttempts int
+}
+
+func NewOutboxService(outboxRep outboxRep, events *EventService, maxAttempts int) *OutboxService {
+	return &OutboxService{
+		outboxRep,
+		events,
+		maxAttempts,
+	}
+}
+
+type OutboxEntryResponse struct {
+	ID            int64     `json:"id"`
+	EventID       int64     `json:"eventId"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"lastError"`
+	CreatedAt     time.Time `json:"createdAt"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	DeadAt        time.Time `json:"deadAt"`
+}
+
+type OutboxStatusResponse struct {
+	Pending         int                    `json:"pending"`
+	Retrying        int                    `json:"retrying"`
+	Dead            int                    `json:"dead"`
+	OldestPendingAt *time.Time             `json:"oldestPendingAt,omitempty"`
+	LagSeconds      float64                `json:"lagSeconds"`
+	DeadLetters     []*OutboxEntryResponse `json:"deadLetters"`
+}
+
+type RetryOutboxResponse struct {
+	Retried int `json:"retried"`
+}
+
+// Run processes the outbox every interval until ctx is done.
+func (s *OutboxService) Run(interval time.Duration, ctx context.Context) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.ProcessPending(ctx)
+
+			err := s.outboxRep.PurgeProcessed(time.Now().Add(-outboxRetention), ctx)
+			if err != nil {
+				log.Printf("error purging processed outbox entries: %v", err)
+			}
+		}
+	}
+}
+
+// RunRecurrenceRefresh queues every recurring event for indexing every
+// interval until ctx is done. Only the occurrences up to recurrenceHorizon
+// ahead are indexed, so series nobody edits would otherwise run out of
+// indexed occurrences.
+func (s *OutboxService) RunRecurrenceRefresh(interval time.Duration, ctx context.Context) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			enqueued, err := s.outboxRep.EnqueueRecurring(ctx)
+			if err != nil {
+				log.Printf("error queueing recurring events for indexing: %v", err)
+				continue
+			}
+
+			log.Printf("queued %d recurring events for indexing", enqueued)
+		}
+	}
+}
+
+// ProcessPending syncs due entries batch by batch until none are left.
+func (s *OutboxService) ProcessPending(ctx context.Context) {
+	for {
+		entries, err := s.outboxRep.ClaimPending(outboxBatchSize, outboxLease, ctx)
+		if err != nil {
+			log.Printf("error claiming outbox entries: %v", err)
+			return
+		}
+
+		if len(entries) == 0 {
+			return
+		}
+
+		// An event written several times since the last batch only has to
+		// be synced once.
+		synced := make(map[int64]error)
+
+		for _, entry := range entries {
+			syncErr, ok := synced[entry.EventID]
+			if !ok {
+				syncErr = s.events.syncSearchIndex(entry.EventID, ctx)
+				synced[entry.EventID] = syncErr
+			}
+
+			if syncErr == nil {
+				err = s.outboxRep.CompleteEntry(entry.ID, ctx)
+				if err != nil {
+					log.Printf("error completing outbox entry %d: %v", entry.ID, err)
+				}
+				continue
+			}
+
+			dead := entry.Attempts+1 >= s.maxAttempts
+			if dead {
+				log.Printf("error syncing event %d to elastic search, giving up after %d attempts: %v", entry.EventID, entry.Attempts+1, syncErr)
+			} else {
+				log.Printf("error syncing event %d to elastic search: %v", entry.EventID, syncErr)
+			}
+
+			err = s.outboxRep.FailEntry(entry.ID, syncErr.Error(), time.Now().Add(outboxBackoff(entry.Attempts)), dead, ctx)
+			if err != nil {
+				log.Printf("error updating outbox entry %d: %v", entry.ID, err)
+			}
+		}
+
+		if len(entries) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// outboxBackoff doubles the delay after each failed attempt, starting at one
+// second.
+func outboxBackoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return outboxMaxBackoff
+	}
+
+	return min(time.Second<<attempts, outboxMaxBackoff)
+}
+
+func newOutboxEntryResponse(oe *models.OutboxEntry) *OutboxEntryResponse {
+	return &OutboxEntryResponse{
+		ID:            oe.ID,
+		EventID:       oe.EventID,
+		Attempts:      oe.Attempts,
+		LastError:     oe.LastError,
+		CreatedAt:     oe.CreatedAt,
+		NextAttemptAt: oe.NextAttemptAt,
+		DeadAt:        oe.DeadAt,
+	}
+}
+
+func (s *OutboxService) GetStatus(ctx context.Context) (*OutboxStatusResponse, error) {
+	stats, err := s.outboxRep.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadEntries, err := s.outboxRep.GetDeadEntries(outboxDeadLetters, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statusResp := &OutboxStatusResponse{
+		Pending:     stats.Pending,
+		Retrying:    stats.Retrying,
+		Dead:        stats.Dead,
+		DeadLetters: make([]*OutboxEntryResponse, 0, len(deadEntries)),
+	}
+
+	if !stats.OldestPendingAt.IsZero() {
+		statusResp.OldestPendingAt = &stats.OldestPendingAt
+		statusResp.LagSeconds = time.Since(stats.OldestPendingAt).Seconds()
+	}
+
+	for _, oe := range deadEntries {
+		statusResp.DeadLetters = append(statusResp.DeadLetters, newOutboxEntryResponse(oe))
+	}
+
+	return statusResp, nil
+}
+
+func (s *OutboxService) RetryDead(ctx context.Context) (*RetryOutboxResponse, error) {
+	retried, err := s.outboxRep.RetryDead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetryOutboxResponse{Retried: retried}, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+// fakeOutboxRep hands out its pending entries once and records what became
+// of them.
+type fakeOutboxRep struct {
+	outboxRep
+	pending   []*models.OutboxEntry
+	completed []int64
+	failed    map[int64]failedEntry
+}
+
+type failedEntry struct {
+	lastError     string
+	nextAttemptAt time.Time
+	dead          bool
+}
+
+func (f *fakeOutboxRep) ClaimPending(limit int, lease time.Duration, ctx context.Context) ([]*models.OutboxEntry, error) {
+	claimed := f.pending[:min(limit, len(f.pending))]
+	f.pending = f.pending[len(claimed):]
+	return claimed, nil
+}
+
+func (f *fakeOutboxRep) CompleteEntry(id int64, ctx context.Context) error {
+	f.completed = append(f.completed, id)
+	return nil
+}
+
+func (f *fakeOutboxRep) FailEntry(id int64, lastError string, nextAttemptAt time.Time, dead bool, ctx context.Context) error {
+	f.failed[id] = failedEntry{lastError, nextAttemptAt, dead}
+	return nil
+}
+
+// flakyIndex fails to index the events in failing.
+type flakyIndex struct {
+	eventSearchRep
+	failing map[int64]bool
+	indexed map[int64]int
+}
+
+func (f *flakyIndex) IndexEvent(event *models.Event, ctx context.Context) error {
+	f.indexed[event.ID]++
+	if f.failing[event.ID] {
+		return errors.New("index unavailable")
+	}
+	return nil
+}
+
+func (f *flakyIndex) PruneEvent(id int64, current []*models.Event, ctx context.Context) error {
+	return nil
+}
+
+func TestOutboxRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+
+	events := newFakeEventStore()
+	synced, _ := events.CreateEvent(&models.Event{Name: "Synced"}, ctx)
+	failing, _ := events.CreateEvent(&models.Event{Name: "Failing"}, ctx)
+
+	index := &flakyIndex{failing: map[int64]bool{failing.ID: true}, indexed: make(map[int64]int)}
+	outbox := &fakeOutboxRep{
+		pending: []*models.OutboxEntry{
+			{ID: 1, EventID: synced.ID},
+			// Written twice since the last batch.
+			{ID: 2, EventID: synced.ID},
+			{ID: 3, EventID: failing.ID, Attempts: 2},
+			{ID: 4, EventID: failing.ID, Attempts: 4},
+		},
+		failed: make(map[int64]failedEntry),
+	}
+
+	s := NewOutboxService(outbox, NewEventService(events, index, nil), 5)
+
+	before := time.Now()
+	s.ProcessPending(ctx)
+
+	if index.indexed[synced.ID] != 1 || index.indexed[failing.ID] != 1 {
+		t.Errorf("got index calls %v, want each event synced once per batch", index.indexed)
+	}
+
+	if len(outbox.completed) != 2 || outbox.completed[0] != 1 || outbox.completed[1] != 2 {
+		t.Errorf("got completed entries %v, want 1 and 2", outbox.completed)
+	}
+
+	retry, ok := outbox.failed[3]
+	if !ok || retry.dead || retry.lastError != "index unavailable" {
+		t.Fatalf("entry 3 not retried: %+v", retry)
+	}
+
+	// The third attempt failed, the next one is due after four seconds.
+	if wait := retry.nextAttemptAt.Sub(before); wait < 4*time.Second || wait > 5*time.Second {
+		t.Errorf("entry 3 retried after %v, want 4s", wait)
+	}
+
+	if dead := outbox.failed[4]; !dead.dead {
+		t.Errorf("entry 4 not dead lettered after its fifth attempt: %+v", dead)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{11, 2048 * time.Second},
+		{12, outboxMaxBackoff},
+		{100, outboxMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"github/eventApp/internal/models"
+	"slices"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// recurrenceHorizon bounds how far ahead recurring events are expanded when
+// no explicit window is given.
+const recurrenceHorizon = 180 * 24 * time.Hour
+
+type Recurrence struct {
+	RRule     string               `json:"rrule"`
+	ExDates   []time.Time          `json:"exDates,omitempty"`
+	Overrides []OccurrenceOverride `json:"overrides,omitempty"`
+}
+
+type OccurrenceOverride struct {
+	RecurrenceID time.Time  `json:"recurrenceId"`
+	Name         *string    `json:"name,omitempty"`
+	Time         *time.Time `json:"time,omitempty"`
+	Location     *string    `json:"location,omitempty"`
+	Latitude     *float64   `json:"latitude,omitempty"`
+	Longitude    *float64   `json:"longitude,omitempty"`
+}
+
+func recurrenceToModel(r *Recurrence) *models.Recurrence {
+	if r == nil {
+		return nil
+	}
+
+	mr := &models.Recurrence{
+		RRule:   r.RRule,
+		ExDates: r.ExDates,
+	}
+
+	for _, o := range r.Overrides {
+		mr.Overrides = append(mr.Overrides, models.OccurrenceOverride(o))
+	}
+
+	return mr
+}
+
+func recurrenceFromModel(mr *models.Recurrence) *Recurrence {
+	if mr == nil {
+		return nil
+	}
+
+	r := &Recurrence{
+		RRule:   mr.RRule,
+		ExDates: mr.ExDates,
+	}
+
+	for _, o := range mr.Overrides {
+		r.Overrides = append(r.Overrides, OccurrenceOverride(o))
+	}
+
+	return r
+}
+
+func validateRecurrence(event *models.Event) error {
+	if event.Timezone != "" {
+		_, err := time.LoadLocation(event.Timezone)
+		if err != nil {
+			return models.Invalidf("invalid timezone %q: %v", event.Timezone, err)
+		}
+	}
+
+	if event.Recurrence == nil {
+		return nil
+	}
+
+	if event.Timezone == "" {
+		return models.Invalidf("recurring events need a timezone")
+	}
+
+	_, err := recurrenceSet(event)
+	if err != nil {
+		return models.Invalidf("invalid recurrence rule %q: %v", event.Recurrence.RRule, err)
+	}
+
+	return nil
+}
+
+// recurrenceSet builds the rule with DTSTART in the event's own timezone, so
+// occurrences keep their wall clock time across daylight saving changes.
+func recurrenceSet(event *models.Event) (*rrule.Set, error) {
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	option, err := rrule.StrToROptionInLocation(event.Recurrence.RRule, loc)
+	if err != nil {
+		return nil, err
+	}
+	option.Dtstart = event.Time.In(loc)
+
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &rrule.Set{}
+	set.RRule(r)
+
+	for _, exDate := range event.Recurrence.ExDates {
+		set.ExDate(exDate.In(loc))
+	}
+
+	return set, nil
+}
+
+// isOccurrence reports whether recurrenceID is the original start of one of
+// the recurring event's occurrences.
+func isOccurrence(event *models.Event, recurrenceID time.Time) (bool, error) {
+	set, err := recurrenceSet(event)
+	if err != nil {
+		return false, err
+	}
+
+	return len(set.Between(recurrenceID, recurrenceID, true)) > 0, nil
+}
+
+// expandOccurrences returns one event per occurrence starting within
+// [from, to], with any per-occurrence overrides applied, ordered by start.
+// Overrides can move occurrences into or out of the window. One-off events
+// are returned as they are.
+func expandOccurrences(event *models.Event, from, to time.Time) ([]*models.Event, error) {
+	if event.Recurrence == nil {
+		return []*models.Event{event}, nil
+	}
+
+	set, err := recurrenceSet(event)
+	if err != nil {
+		return nil, err
+	}
+
+	starts := set.Between(from, to, true)
+
+	for _, o := range event.Recurrence.Overrides {
+		if o.Time == nil || o.Time.Before(from) || o.Time.After(to) {
+			continue
+		}
+
+		// The occurrence was moved into the window from outside of it.
+		moved := set.Between(o.RecurrenceID, o.RecurrenceID, true)
+		if len(moved) > 0 && !slices.ContainsFunc(starts, moved[0].Equal) {
+			starts = append(starts, moved[0])
+		}
+	}
+
+	occurrences := make([]*models.Event, 0, len(starts))
+
+	for _, start := range starts {
+		recurrenceID := start
+		occurrence := *event
+		occurrence.Time = start
+		occurrence.RecurrenceID = &recurrenceID
+
+		for _, o := range event.Recurrence.Overrides {
+			if !o.RecurrenceID.Equal(start) {
+				continue
+			}
+
+			if o.Name != nil {
+				occurrence.Name = *o.Name
+			}
+			if o.Time != nil {
+				occurrence.Time = *o.Time
+			}
+			if o.Location != nil {
+				occurrence.Location = *o.Location
+			}
+			if o.Latitude != nil {
+				occurrence.Latitude = *o.Latitude
+			}
+			if o.Longitude != nil {
+				occurrence.Longitude = *o.Longitude
+			}
+		}
+
+		if occurrence.Time.Before(from) || occurrence.Time.After(to) {
+			continue
+		}
+
+		// Occurrences last as long as the series' first event.
+		if event.Details != nil && event.Details.EndTime != nil {
+			details := *event.Details
+			endTime := occurrence.Time.Add(event.Details.EndTime.Sub(event.Time))
+			details.EndTime = &endTime
+			occurrence.Details = &details
+		}
+
+		occurrences = append(occurrences, &occurrence)
+	}
+
+	slices.SortFunc(occurrences, func(a, b *models.Event) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return occurrences, nil
+}
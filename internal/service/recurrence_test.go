@@ -0,0 +1,96 @@
+package service
+
+import (
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+func TestExpandOccurrencesKeepsLocalTimeAcrossDST(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	// Weekly on Fridays, across the changes on the last Sundays of March and
+	// October 2026.
+	event := &models.Event{
+		Name:       "Friday social",
+		Time:       time.Date(2026, 3, 20, 19, 0, 0, 0, berlin),
+		Timezone:   "Europe/Berlin",
+		Recurrence: &models.Recurrence{RRule: "FREQ=WEEKLY;UNTIL=20261106T230000Z"},
+	}
+
+	occurrences, err := expandOccurrences(event, event.Time, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expandOccurrences: %v", err)
+	}
+
+	if len(occurrences) != 34 {
+		t.Fatalf("got %d occurrences, want 34", len(occurrences))
+	}
+
+	for _, o := range occurrences {
+		local := o.Time.In(berlin)
+		if local.Weekday() != time.Friday || local.Hour() != 19 || local.Minute() != 0 {
+			t.Errorf("occurrence at %v, want Fridays at 19:00 in Berlin", local)
+		}
+	}
+
+	// 19:00 is 18:00 UTC in winter and 17:00 UTC in summer.
+	wantUTC := map[time.Time]int{
+		time.Date(2026, 3, 27, 0, 0, 0, 0, time.UTC):  18,
+		time.Date(2026, 4, 3, 0, 0, 0, 0, time.UTC):   17,
+		time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC): 17,
+		time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC): 18,
+	}
+
+	for _, o := range occurrences {
+		utc := o.Time.UTC()
+		day := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+		if hour, ok := wantUTC[day]; ok && utc.Hour() != hour {
+			t.Errorf("occurrence on %s at %02d:00 UTC, want %02d:00", day.Format(time.DateOnly), utc.Hour(), hour)
+		}
+	}
+}
+
+func TestExpandOccurrencesMovedIntoWindow(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	start := time.Date(2026, 6, 5, 19, 0, 0, 0, berlin)
+	movedFrom := start.AddDate(0, 0, 14)
+	movedTo := start.AddDate(0, 0, 8)
+	movedOut := start.AddDate(0, 0, 7)
+	later := start.AddDate(0, 0, 30)
+	name := "Moved social"
+
+	event := &models.Event{
+		Name:     "Friday social",
+		Time:     start,
+		Timezone: "Europe/Berlin",
+		Recurrence: &models.Recurrence{
+			RRule: "FREQ=WEEKLY",
+			Overrides: []models.OccurrenceOverride{
+				{RecurrenceID: movedFrom, Name: &name, Time: &movedTo},
+				{RecurrenceID: movedOut, Time: &later},
+			},
+		},
+	}
+
+	// The window holds the first two occurrences, the second one moved out
+	// of it, and the third one moved in.
+	occurrences, err := expandOccurrences(event, start, start.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatalf("expandOccurrences: %v", err)
+	}
+
+	if len(occurrences) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(occurrences))
+	}
+
+	if !occurrences[0].Time.Equal(start) {
+		t.Errorf("first occurrence at %v, want %v", occurrences[0].Time, start)
+	}
+
+	moved := occurrences[1]
+	if !moved.Time.Equal(movedTo) || moved.Name != name || !moved.RecurrenceID.Equal(movedFrom) {
+		t.Errorf("got %q at %v for %v, want %q at %v for %v", moved.Name, moved.Time, moved.RecurrenceID, name, movedTo, movedFrom)
+	}
+}
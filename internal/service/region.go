@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+)
+
+type regionRep interface {
+	GetRegion(name string, ctx context.Context) (*models.Region, error)
+	GetRegions(ctx context.Context) ([]*models.Region, error)
+}
+
+// UseRegions lets searches be limited to the named regions of regions.
+func (e *EventService) UseRegions(regions regionRep) {
+	e.regions = regions
+}
+
+type RegionResponse struct {
+	Name string `json:"name"`
+}
+
+func (e *EventService) GetRegions(ctx context.Context) ([]*RegionResponse, error) {
+	if e.regions == nil {
+		return []*RegionResponse{}, nil
+	}
+
+	regions, err := e.regions.GetRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	regionsResp := make([]*RegionResponse, 0, len(regions))
+	for _, r := range regions {
+		regionsResp = append(regionsResp, &RegionResponse{Name: r.Name})
+	}
+
+	return regionsResp, nil
+}
+
+// searchArea resolves a region name or a drawn polygon to the polygons to
+// search in, nil when neither is given.
+func (e *EventService) searchArea(region string, polygon [][2]float64, ctx context.Context) ([]models.Polygon, error) {
+	if region != "" && len(polygon) > 0 {
+		return nil, models.Invalidf("a region and a polygon can't be combined")
+	}
+
+	if region != "" {
+		if e.regions == nil {
+			return nil, models.Invalidf("unknown region %q", region)
+		}
+
+		r, err := e.regions.GetRegion(region, ctx)
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, models.Invalidf("unknown region %q", region)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return r.Polygons, nil
+	}
+
+	if len(polygon) == 0 {
+		return nil, nil
+	}
+
+	if len(polygon) < 3 {
+		return nil, models.Invalidf("a polygon needs at least 3 points")
+	}
+
+	ring := make([]models.GeoPoint, 0, len(polygon)+1)
+	for _, p := range polygon {
+		// Written so that NaN fails too.
+		if !(p[0] >= -90 && p[0] <= 90 && p[1] >= -180 && p[1] <= 180) {
+			return nil, models.Invalidf("invalid polygon point %v, %v", p[0], p[1])
+		}
+		ring = append(ring, models.GeoPoint{Latitude: p[0], Longitude: p[1]})
+	}
+
+	// Drawn polygons may leave the ring open.
+	if ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+
+	return []models.Polygon{{ring}}, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"github/eventApp/internal/models"
+	"log"
+	"time"
+)
+
+const (
+	reindexBatchSize = 500
+	// reindexReplayMargin widens the window of replayed outbox entries to
+	// cover writes whose transaction started shortly before the reindex.
+	reindexReplayMargin = time.Minute
+)
+
+type searchIndexBuilder interface {
+	CreateVersionedIndex(ctx context.Context) (string, error)
+	BulkIndexEvents(indexName string, events []*models.Event, ctx context.Context) error
+	SwapAlias(indexName string, ctx context.Context) error
+	DeleteIndex(indexName string, ctx context.Context) error
+}
+
+type reindexEventRep interface {
+	GetAllEvents(ctx context.Context) ([]*models.Event, error)
+}
+
+type reindexOutboxRep interface {
+	RequeueSince(since time.Time, ctx context.Context) (int, error)
+}
+
+// ReindexService rebuilds the search index from Postgres into a new index
+// and swaps the alias over to it, so searches keep working throughout.
+type ReindexService struct {
+	eventRep     reindexEventRep
+	indexBuilder searchIndexBuilder
+	outboxRep    reindexOutboxRep
+}
+
+func NewReindexService(eventRep reindexEventRep, indexBuilder searchIndexBuilder, outboxRep reindexOutboxRep) *ReindexService {
+	return &ReindexService{
+		eventRep,
+		indexBuilder,
+		outboxRep,
+	}
+}
+
+type ReindexResult struct {
+	Index     string
+	Events    int
+	Documents int
+	Requeued  int
+}
+
+// Reindex copies every event into a fresh index. Events written while it runs
+// still go to the old index through the alias, so their outbox entries are
+// replayed against the new index once the alias has been swapped.
+func (s *ReindexService) Reindex(ctx context.Context) (*ReindexResult, error) {
+	start := time.Now().Add(-reindexReplayMargin)
+
+	name, err := s.indexBuilder.CreateVersionedIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.fill(name, ctx)
+	if err != nil {
+		deleteErr := s.indexBuilder.DeleteIndex(name, ctx)
+		if deleteErr != nil {
+			log.Printf("error deleting unfinished index %s: %v", name, deleteErr)
+		}
+		return nil, err
+	}
+
+	err = s.indexBuilder.SwapAlias(name, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Requeued, err = s.outboxRep.RequeueSince(start, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *ReindexService) fill(name string, ctx context.Context) (*ReindexResult, error) {
+	events, err := s.eventRep.GetAllEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReindexResult{Index: name, Events: len(events)}
+	now := time.Now()
+	batch := make([]*models.Event, 0, reindexBatchSize)
+
+	for _, event := range events {
+		occurrences, err := expandOccurrences(event, now, now.Add(recurrenceHorizon))
+		if err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, occurrences...)
+		result.Documents += len(occurrences)
+
+		if len(batch) >= reindexBatchSize {
+			err = s.indexBuilder.BulkIndexEvents(name, batch, ctx)
+			if err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	err = s.indexBuilder.BulkIndexEvents(name, batch, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
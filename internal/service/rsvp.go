@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github/eventApp/internal/models"
+	"time"
+)
+
+type rsvpRep interface {
+	SetRSVP(rsvp *models.RSVP, ctx context.Context) (*models.RSVP, error)
+	RemoveRSVP(eventID int64, recurrenceID *time.Time, userID int64, ctx context.Context) error
+	GetRSVPs(eventID int64, recurrenceID *time.Time, ctx context.Context) ([]*models.RSVP, error)
+}
+
+type RSVPService struct {
+	rsvpRep  rsvpRep
+	eventRep eventGetter
+}
+
+func NewRSVPService(rsvpRep rsvpRep, eventRep eventGetter) *RSVPService {
+	return &RSVPService{
+		rsvpRep,
+		eventRep,
+	}
+}
+
+type SetRSVPRequest struct {
+	GroupID int64 `json:"groupId"`
+	EventID int64 `json:"eventId"`
+	// RecurrenceID picks the occurrence of a recurring event, by its
+	// original start, and is left out for one-off events.
+	RecurrenceID *time.Time `json:"recurrenceId,omitempty"`
+	UserID       int64      `json:"userId"`
+	Status       string     `json:"status"`
+	Role         string     `json:"role"`
+}
+
+type RSVPResponse struct {
+	EventID      int64      `json:"eventId"`
+	RecurrenceID *time.Time `json:"recurrenceId,omitempty"`
+	UserID       int64      `json:"userId"`
+	Status       string     `json:"status"`
+	Role         string     `json:"role,omitempty"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func newRSVPResponse(r *models.RSVP) *RSVPResponse {
+	return &RSVPResponse{
+		EventID:      r.EventID,
+		RecurrenceID: r.RecurrenceID,
+		UserID:       r.UserID,
+		Status:       r.Status,
+		Role:         r.Role,
+		UpdatedAt:    r.UpdatedAt,
+	}
+}
+
+// occurrenceIn loads an event of the group and checks that recurrenceID is
+// one of its occurrences. Each occurrence of a recurring event has its own
+// seats and waitlist, so one has to be picked, one-off events are answered
+// as a whole.
+func occurrenceIn(events eventGetter, groupID, eventID int64, recurrenceID *time.Time, ctx context.Context) error {
+	event, err := eventInGroup(events, groupID, eventID, ctx)
+	if err != nil {
+		return err
+	}
+
+	if event.Recurrence == nil {
+		if recurrenceID != nil {
+			return models.Invalidf("event %d isn't recurring, it can't be answered per occurrence", eventID)
+		}
+		return nil
+	}
+
+	if recurrenceID == nil {
+		return models.Invalidf("event %d is recurring, a recurrenceId is required", eventID)
+	}
+
+	ok, err := isOccurrence(event, *recurrenceID)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("occurrence %s of event %d: %w", recurrenceID.Format(time.RFC3339), eventID, models.ErrNotFound)
+	}
+
+	return nil
+}
+
+func validRSVPStatus(status string) bool {
+	switch status {
+	case models.RSVPGoing, models.RSVPInterested, models.RSVPNotGoing:
+		return true
+	}
+	return false
+}
+
+func validRole(role string) bool {
+	switch role {
+	case "", models.RoleLead, models.RoleFollow, models.RoleBoth:
+		return true
+	}
+	return false
+}
+
+func (s *RSVPService) SetRSVP(srr *SetRSVPRequest, ctx context.Context) (*RSVPResponse, error) {
+
+	if !validRSVPStatus(srr.Status) {
+		return nil, models.Invalidf("invalid rsvp status %q", srr.Status)
+	}
+
+	if !validRole(srr.Role) {
+		return nil, models.Invalidf("invalid dance role %q", srr.Role)
+	}
+
+	err := occurrenceIn(s.eventRep, srr.GroupID, srr.EventID, srr.RecurrenceID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rsvp := &models.RSVP{
+		EventID:      srr.EventID,
+		RecurrenceID: srr.RecurrenceID,
+		UserID:       srr.UserID,
+		Status:       srr.Status,
+		Role:         srr.Role,
+	}
+
+	savedRSVP, err := s.rsvpRep.SetRSVP(rsvp, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRSVPResponse(savedRSVP), nil
+}
+
+type RemoveRSVPRequest struct {
+	GroupID      int64      `json:"groupId"`
+	EventID      int64      `json:"eventId"`
+	RecurrenceID *time.Time `json:"recurrenceId,omitempty"`
+	UserID       int64      `json:"userId"`
+}
+
+func (s *RSVPService) RemoveRSVP(rrr *RemoveRSVPRequest, ctx context.Context) error {
+
+	err := occurrenceIn(s.eventRep, rrr.GroupID, rrr.EventID, rrr.RecurrenceID, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.rsvpRep.RemoveRSVP(rrr.EventID, rrr.RecurrenceID, rrr.UserID, ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RSVPService) GetRSVPs(groupID, eventID int64, recurrenceID *time.Time, ctx context.Context) ([]*RSVPResponse, error) {
+
+	err := occurrenceIn(s.eventRep, groupID, eventID, recurrenceID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rsvps, err := s.rsvpRep.GetRSVPs(eventID, recurrenceID, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rsvpsResp := make([]*RSVPResponse, 0, len(rsvps))
+
+	for _, r := range rsvps {
+		rsvpsResp = append(rsvpsResp, newRSVPResponse(r))
+	}
+
+	return rsvpsResp, nil
+}
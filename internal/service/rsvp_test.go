@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github/eventApp/internal/models"
+	"testing"
+	"time"
+)
+
+// fakeRSVPRep keeps the answers it's given.
+type fakeRSVPRep struct {
+	rsvps []*models.RSVP
+}
+
+func (f *fakeRSVPRep) SetRSVP(rsvp *models.RSVP, ctx context.Context) (*models.RSVP, error) {
+	f.rsvps = append(f.rsvps, rsvp)
+	return rsvp, nil
+}
+
+func (f *fakeRSVPRep) RemoveRSVP(eventID int64, recurrenceID *time.Time, userID int64, ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeRSVPRep) GetRSVPs(eventID int64, recurrenceID *time.Time, ctx context.Context) ([]*models.RSVP, error) {
+	return f.rsvps, nil
+}
+
+func TestSetRSVPPerOccurrence(t *testing.T) {
+	ctx := context.Background()
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	start := time.Date(2026, 6, 5, 19, 0, 0, 0, berlin)
+	nextWeek := start.AddDate(0, 0, 7)
+	offSeries := start.AddDate(0, 0, 1)
+
+	events := newFakeEventStore()
+	series, _ := events.CreateEvent(&models.Event{
+		Name:       "Friday social",
+		GroupID:    7,
+		Time:       start,
+		Timezone:   "Europe/Berlin",
+		Recurrence: &models.Recurrence{RRule: "FREQ=WEEKLY"},
+	}, ctx)
+	oneOff, _ := events.CreateEvent(&models.Event{Name: "Workshop", GroupID: 7, Time: start}, ctx)
+
+	rsvps := &fakeRSVPRep{}
+	s := NewRSVPService(rsvps, events)
+
+	tests := []struct {
+		name         string
+		eventID      int64
+		recurrenceID *time.Time
+		wantErr      error
+	}{
+		{name: "occurrence", eventID: series.ID, recurrenceID: &nextWeek},
+		{name: "series without occurrence", eventID: series.ID, wantErr: &models.ValidationError{}},
+		{name: "not an occurrence", eventID: series.ID, recurrenceID: &offSeries, wantErr: models.ErrNotFound},
+		{name: "one-off", eventID: oneOff.ID},
+		{name: "one-off with occurrence", eventID: oneOff.ID, recurrenceID: &start, wantErr: &models.ValidationError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsvps.rsvps = nil
+
+			_, err := s.SetRSVP(&SetRSVPRequest{
+				GroupID:      7,
+				EventID:      tt.eventID,
+				RecurrenceID: tt.recurrenceID,
+				UserID:       1,
+				Status:       models.RSVPGoing,
+			}, ctx)
+
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("SetRSVP: %v", err)
+				}
+				if len(rsvps.rsvps) != 1 || rsvps.rsvps[0].RecurrenceID != tt.recurrenceID {
+					t.Errorf("got saved answers %+v, want one for the occurrence", rsvps.rsvps)
+				}
+			case *models.ValidationError:
+				if !errors.As(err, &want) {
+					t.Errorf("got error %v, want a validation error", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("got error %v, want %v", err, want)
+				}
+			}
+
+			if tt.wantErr != nil && len(rsvps.rsvps) != 0 {
+				t.Errorf("answer saved despite error")
+			}
+		})
+	}
+}
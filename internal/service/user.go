@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github/eventApp/internal/models"
 
@@ -12,6 +14,7 @@ type userRep interface {
 	CreateUser(user *models.User, ctx context.Context) (*models.User, error)
 	UpdateUser(id int64, user *models.User, ctx context.Context) (*models.User, error)
 	GetUser(id int64, ctx context.Context) (*models.User, error)
+	SetCalendarToken(id int64, token string, ctx context.Context) error
 }
 
 type UserService struct {
@@ -131,3 +134,31 @@ func (s *UserService) UpdateUser(id int64, uur *UpdateUserRequest, ctx context.C
 	return uuResp, nil
 
 }
+
+type CalendarTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// RotateCalendarToken issues a new secret for the user's calendar feeds,
+// invalidating any previously shared feed URLs.
+func (s *UserService) RotateCalendarToken(id int64, ctx context.Context) (*CalendarTokenResponse, error) {
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("error generating calendar token")
+	}
+
+	token := hex.EncodeToString(b)
+
+	err = s.userRep.SetCalendarToken(id, token, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctResp := &CalendarTokenResponse{
+		Token: token,
+	}
+
+	return ctResp, nil
+}